@@ -0,0 +1,49 @@
+package adapters
+
+import (
+	"errors"
+
+	"github.com/larisgo/laravel-echo-server/options"
+)
+
+// The connections of this server node.
+type Local interface {
+	// Emit an event to the local connections of a channel, except the given connection id, with its history sequence unless zero.
+	EmitLocal(string, string, any, string, int64) error
+
+	// Get the ids of the local connections subscribed to a channel.
+	LocalClients(string) ([]string, error)
+
+	// Get the local open channels and their subscription count.
+	LocalChannels() map[string]int
+
+	// Get the number of local open connections.
+	LocalCount() int
+}
+
+type Adapter interface {
+	// Publish an event to the other server nodes, with its history sequence unless zero.
+	Publish(string, string, any, string, int64) error
+
+	// Get the ids of the connections subscribed to a channel on the other server nodes.
+	Clients(string) ([]string, error)
+
+	// Get the open channels and their subscription count on the other server nodes.
+	Channels() (map[string]int, error)
+
+	// Get the number of open connections on the other server nodes.
+	Count() (int, error)
+
+	Close() error
+}
+
+// Create a new cluster adapter instance.
+func NewAdapter(local Local, _options *options.Config) (Adapter, error) {
+	switch _options.Cluster.Adapter {
+	case "", "local":
+		return NewLocalAdapter(), nil
+	case "redis":
+		return NewRedisAdapter(local, _options)
+	}
+	return nil, errors.New("The cluster adapter is invalid.")
+}
@@ -0,0 +1,24 @@
+package adapters
+
+type RedisAdapterMessage struct {
+	Uid     string `json:"uid"`
+	Channel string `json:"channel"`
+	Event   string `json:"event"`
+	Data    any    `json:"data"`
+	Except  string `json:"except"`
+	Seq     int64  `json:"seq,omitempty"`
+}
+
+type RedisAdapterRequest struct {
+	Uid       string `json:"uid"`
+	RequestId string `json:"request_id"`
+	Type      string `json:"type"`
+	Channel   string `json:"channel"`
+}
+
+type RedisAdapterResponse struct {
+	RequestId string         `json:"request_id"`
+	Clients   []string       `json:"clients,omitempty"`
+	Channels  map[string]int `json:"channels,omitempty"`
+	Count     int            `json:"count"`
+}
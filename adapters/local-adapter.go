@@ -0,0 +1,30 @@
+package adapters
+
+// Adapter of a single server node, there is nobody to talk to.
+type LocalAdapter struct {
+}
+
+// Create a new local adapter instance.
+func NewLocalAdapter() Adapter {
+	return &LocalAdapter{}
+}
+
+func (adapter *LocalAdapter) Publish(channel string, event string, data any, except string, seq int64) error {
+	return nil
+}
+
+func (adapter *LocalAdapter) Clients(channel string) ([]string, error) {
+	return []string{}, nil
+}
+
+func (adapter *LocalAdapter) Channels() (map[string]int, error) {
+	return map[string]int{}, nil
+}
+
+func (adapter *LocalAdapter) Count() (int, error) {
+	return 0, nil
+}
+
+func (adapter *LocalAdapter) Close() error {
+	return nil
+}
@@ -0,0 +1,324 @@
+package adapters
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/larisgo/laravel-echo-server/database"
+	"github.com/larisgo/laravel-echo-server/options"
+	_utils "github.com/larisgo/laravel-echo-server/utils"
+	"github.com/zishang520/engine.io/utils"
+)
+
+// Prefix of the redis channels used by the cluster nodes to talk to each other.
+const RedisChannelPrefix = "laravel-echo-server#"
+
+// Request types.
+const (
+	requestClients  = "clients"
+	requestChannels = "channels"
+	requestCount    = "count"
+)
+
+type RedisAdapter struct {
+
+	// Redis client.
+	redis redis.UniversalClient
+
+	// Subscription to the channels of the cluster.
+	pubsub *redis.PubSub
+
+	// The connections of this node.
+	local Local
+
+	// Configurable server options.
+	options *options.Config
+
+	// The id of this node.
+	uid string
+
+	// Channel of the published events.
+	broadcastChannel string
+
+	// Channel of the requests to all nodes.
+	requestChannel string
+
+	// Channel of the responses to this node.
+	responseChannel string
+
+	// Pending requests by id.
+	requests sync.Map
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// Create a new redis adapter instance.
+func NewRedisAdapter(local Local, _options *options.Config) (Adapter, error) {
+	adapter := &RedisAdapter{}
+	adapter.ctx, adapter.cancel = context.WithCancel(context.Background())
+	adapter.local = local
+	adapter.options = _options
+
+	uid := _utils.NodeId
+	adapter.uid = uid
+	adapter.broadcastChannel = RedisChannelPrefix + "broadcast"
+	adapter.requestChannel = RedisChannelPrefix + "request"
+	adapter.responseChannel = RedisChannelPrefix + "response#" + uid
+
+	client, err := database.NewRedisClient(_options)
+	if err != nil {
+		return nil, err
+	}
+	adapter.redis = client
+
+	adapter.pubsub = adapter.redis.Subscribe(adapter.ctx, adapter.broadcastChannel, adapter.requestChannel, adapter.responseChannel)
+	// Wait for the subscription, so the node is counted by the other nodes right away.
+	if _, err := adapter.pubsub.Receive(adapter.ctx); err != nil {
+		adapter.pubsub.Close()
+		database.ReleaseRedisClient()
+		return nil, errors.New(fmt.Sprintf("Redis subscription failed: %v", err))
+	}
+	go adapter.listen(adapter.pubsub)
+
+	utils.Log().Success("Joined the redis cluster as node %s", uid)
+	return adapter, nil
+}
+
+// Handle the messages of the other nodes.
+func (adapter *RedisAdapter) listen(pubsub *redis.PubSub) {
+	defer pubsub.Close()
+
+	for msg := range pubsub.Channel() {
+		switch msg.Channel {
+		case adapter.broadcastChannel:
+			adapter.onBroadcast([]byte(msg.Payload))
+		case adapter.requestChannel:
+			adapter.onRequest([]byte(msg.Payload))
+		case adapter.responseChannel:
+			adapter.onResponse([]byte(msg.Payload))
+		}
+	}
+}
+
+// Emit an event published by another node to the local connections.
+func (adapter *RedisAdapter) onBroadcast(payload []byte) {
+	var message *RedisAdapterMessage
+	if err := json.Unmarshal(payload, &message); err != nil {
+		if adapter.options.DevMode {
+			utils.Log().Error("%v", err)
+		}
+		return
+	}
+	if message.Uid == adapter.uid {
+		return
+	}
+	adapter.local.EmitLocal(message.Channel, message.Event, message.Data, message.Except, message.Seq)
+}
+
+// Answer a request of another node with the local state.
+func (adapter *RedisAdapter) onRequest(payload []byte) {
+	var request *RedisAdapterRequest
+	if err := json.Unmarshal(payload, &request); err != nil {
+		if adapter.options.DevMode {
+			utils.Log().Error("%v", err)
+		}
+		return
+	}
+	if request.Uid == adapter.uid {
+		return
+	}
+
+	response := &RedisAdapterResponse{RequestId: request.RequestId}
+	switch request.Type {
+	case requestClients:
+		clients, err := adapter.local.LocalClients(request.Channel)
+		if err != nil {
+			if adapter.options.DevMode {
+				utils.Log().Error("%v", err)
+			}
+			return
+		}
+		response.Clients = clients
+	case requestChannels:
+		response.Channels = adapter.local.LocalChannels()
+	case requestCount:
+		response.Count = adapter.local.LocalCount()
+	default:
+		return
+	}
+
+	data, err := json.Marshal(response)
+	if err != nil {
+		return
+	}
+	adapter.redis.Publish(adapter.ctx, RedisChannelPrefix+"response#"+request.Uid, data)
+}
+
+// Hand a response over to the pending request.
+func (adapter *RedisAdapter) onResponse(payload []byte) {
+	var response *RedisAdapterResponse
+	if err := json.Unmarshal(payload, &response); err != nil {
+		if adapter.options.DevMode {
+			utils.Log().Error("%v", err)
+		}
+		return
+	}
+	if responses, ok := adapter.requests.Load(response.RequestId); ok {
+		select {
+		case responses.(chan *RedisAdapterResponse) <- response:
+		default:
+		}
+	}
+}
+
+// Publish an event to the other nodes.
+func (adapter *RedisAdapter) Publish(channel string, event string, data any, except string, seq int64) error {
+	payload, err := json.Marshal(&RedisAdapterMessage{
+		Uid:     adapter.uid,
+		Channel: channel,
+		Event:   event,
+		Data:    data,
+		Except:  except,
+		Seq:     seq,
+	})
+	if err != nil {
+		return err
+	}
+	return adapter.redis.Publish(adapter.ctx, adapter.broadcastChannel, payload).Err()
+}
+
+// Send a request to the other nodes and wait for them to respond, returning the
+// responses that arrived in time once the timeout is reached.
+func (adapter *RedisAdapter) request(_type string, channel string) ([]*RedisAdapterResponse, error) {
+	expected, err := adapter.nodes()
+	if err != nil {
+		return nil, err
+	}
+	expected--
+	if expected <= 0 {
+		return []*RedisAdapterResponse{}, nil
+	}
+
+	requestId, err := randomId()
+	if err != nil {
+		return nil, err
+	}
+	payload, err := json.Marshal(&RedisAdapterRequest{
+		Uid:       adapter.uid,
+		RequestId: requestId,
+		Type:      _type,
+		Channel:   channel,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	responses := make(chan *RedisAdapterResponse, expected)
+	adapter.requests.Store(requestId, responses)
+	defer adapter.requests.Delete(requestId)
+
+	if err := adapter.redis.Publish(adapter.ctx, adapter.requestChannel, payload).Err(); err != nil {
+		return nil, err
+	}
+
+	timeout := time.NewTimer(time.Duration(adapter.options.Cluster.RequestTimeout) * time.Millisecond)
+	defer timeout.Stop()
+
+	results := make([]*RedisAdapterResponse, 0, expected)
+	for len(results) < expected {
+		select {
+		case response := <-responses:
+			results = append(results, response)
+		case <-timeout.C:
+			if adapter.options.DevMode {
+				utils.Log().Warning("Timeout reached while waiting for %s response, got %d of %d", _type, len(results), expected)
+			}
+			return results, nil
+		case <-adapter.ctx.Done():
+			return nil, adapter.ctx.Err()
+		}
+	}
+	return results, nil
+}
+
+// Count the nodes subscribed to the requests. In a redis cluster, the
+// subscriptions are counted on the node they were made through.
+func (adapter *RedisAdapter) nodes() (int, error) {
+	var client redis.Cmdable = adapter.redis
+	if cluster, ok := adapter.redis.(*redis.ClusterClient); ok {
+		master, err := cluster.MasterForKey(adapter.ctx, adapter.broadcastChannel)
+		if err != nil {
+			return 0, err
+		}
+		client = master
+	}
+	numsub, err := client.PubSubNumSub(adapter.ctx, adapter.requestChannel).Result()
+	if err != nil {
+		return 0, err
+	}
+	return int(numsub[adapter.requestChannel]), nil
+}
+
+// Get the ids of the connections subscribed to a channel on the other nodes.
+func (adapter *RedisAdapter) Clients(channel string) ([]string, error) {
+	responses, err := adapter.request(requestClients, channel)
+	if err != nil {
+		return nil, err
+	}
+	clients := []string{}
+	for _, response := range responses {
+		clients = append(clients, response.Clients...)
+	}
+	return clients, nil
+}
+
+// Get the open channels and their subscription count on the other nodes.
+func (adapter *RedisAdapter) Channels() (map[string]int, error) {
+	responses, err := adapter.request(requestChannels, "")
+	if err != nil {
+		return nil, err
+	}
+	channels := map[string]int{}
+	for _, response := range responses {
+		for channel, count := range response.Channels {
+			channels[channel] += count
+		}
+	}
+	return channels, nil
+}
+
+// Get the number of open connections on the other nodes.
+func (adapter *RedisAdapter) Count() (int, error) {
+	responses, err := adapter.request(requestCount, "")
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, response := range responses {
+		count += response.Count
+	}
+	return count, nil
+}
+
+func (adapter *RedisAdapter) Close() error {
+	adapter.cancel()
+	adapter.pubsub.Close()
+	return database.ReleaseRedisClient()
+}
+
+// Generate a random id.
+func randomId() (string, error) {
+	data := make([]byte, 8)
+	if _, err := rand.Read(data); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(data), nil
+}
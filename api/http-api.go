@@ -5,14 +5,17 @@ import (
 	"io"
 	"net/http"
 	"runtime"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/julienschmidt/httprouter"
 	"github.com/larisgo/laravel-echo-server/channels"
 	"github.com/larisgo/laravel-echo-server/express"
 	"github.com/larisgo/laravel-echo-server/options"
-	"github.com/zishang520/engine.io/types"
+	"github.com/larisgo/laravel-echo-server/subscribers"
+	"github.com/larisgo/laravel-echo-server/types"
 	"github.com/zishang520/engine.io/utils"
 	"github.com/zishang520/socket.io/socket"
 )
@@ -35,6 +38,11 @@ type HttpApi struct {
 
 	// Socket.io client.
 	io *socket.Server
+
+	// Latest state of each subscriber.
+	subscribers map[string]*subscribers.Status
+
+	mu sync.RWMutex
 }
 
 // Create new instance of http subscriber.
@@ -44,9 +52,18 @@ func NewHttpApi(io *socket.Server, channel *channels.Channel, express *express.E
 	api.channel = channel
 	api.express = express
 	api.options = _options
+	api.subscribers = map[string]*subscribers.Status{}
 	return api
 }
 
+// Show the state of a subscriber in the status.
+func (api *HttpApi) SetSubscriberStatus(status *subscribers.Status) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+
+	api.subscribers[status.Subscriber] = status
+}
+
 // Initialize the API.
 func (api *HttpApi) Init() {
 	api.corsMiddleware()
@@ -61,6 +78,8 @@ func (api *HttpApi) Init() {
 
 	api.express.Route().GET("/apps/:appId/channels/:channelName/users", api.express.AuthorizeRequests(api.GetChannelUsers))
 
+	api.express.Route().DELETE("/apps/:appId/users/:userId/auth_cache", api.express.AuthorizeRequests(api.DeleteUserAuthCache))
+
 }
 
 // Add CORS middleware if applicable.
@@ -87,10 +106,30 @@ func (api *HttpApi) GetStatus(w http.ResponseWriter, r *http.Request, router htt
 	var m runtime.MemStats
 	runtime.ReadMemStats(&m)
 
+	subscriptionCount, err := api.channel.Broadcaster.Count()
+	if err != nil {
+		if api.options.DevMode {
+			utils.Log().Error("%v", err)
+		}
+		api.badResponse(w, r, err.Error())
+		return
+	}
+
+	api.mu.RLock()
+	statuses := []*subscribers.Status{}
+	for _, status := range api.subscribers {
+		statuses = append(statuses, status)
+	}
+	api.mu.RUnlock()
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Subscriber < statuses[j].Subscriber
+	})
+
 	data, err := json.Marshal(map[string]any{
-		"subscription_count": api.io.Engine().ClientsCount(),
+		"subscription_count": subscriptionCount,
 		"uptime":             time.Since(startTime),
 		"memory_usage":       m.TotalAlloc,
+		"subscribers":        statuses,
 	})
 	if err != nil {
 		if api.options.DevMode {
@@ -108,23 +147,24 @@ func (api *HttpApi) GetStatus(w http.ResponseWriter, r *http.Request, router htt
 // Get a list of the open channels on the server.
 func (api *HttpApi) GetChannels(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	prefix := r.URL.Query().Get("filter_by_prefix")
-	rooms := api.io.Sockets().Adapter().Rooms()
-	channels := map[socket.Room]map[string]any{}
-	rooms.Range(func(channelName, sockets any) bool {
-		cn := channelName.(socket.Room)
-		ss := sockets.(*types.Set[socket.SocketId])
-		if ss.Has(socket.SocketId(cn)) {
-			return true
+	rooms, err := api.channel.Broadcaster.Channels()
+	if err != nil {
+		if api.options.DevMode {
+			utils.Log().Error("%v", err)
 		}
-		if prefix != "" && strings.Index(string(cn), prefix) != 0 {
-			return true
+		api.badResponse(w, r, err.Error())
+		return
+	}
+	channels := map[string]map[string]any{}
+	for channelName, subscriptionCount := range rooms {
+		if prefix != "" && strings.Index(channelName, prefix) != 0 {
+			continue
 		}
-		channels[cn] = map[string]any{
-			"subscription_count": ss.Len(),
+		channels[channelName] = map[string]any{
+			"subscription_count": subscriptionCount,
 			"occupied":           true,
 		}
-		return true
-	})
+	}
 
 	data, err := json.Marshal(map[string]any{
 		"channels": channels,
@@ -145,10 +185,15 @@ func (api *HttpApi) GetChannels(w http.ResponseWriter, r *http.Request, _ httpro
 // Get a information about a channel.
 func (api *HttpApi) GetChannel(w http.ResponseWriter, r *http.Request, router httprouter.Params) {
 	channelName := router.ByName("channelName")
-	subscriptionCount := 0
-	if sockets, ok := api.io.Sockets().Adapter().Rooms().Load(socket.Room(channelName)); ok {
-		subscriptionCount = sockets.(*types.Set[socket.SocketId]).Len()
+	rooms, err := api.channel.Broadcaster.Channels()
+	if err != nil {
+		if api.options.DevMode {
+			utils.Log().Error("%v", err)
+		}
+		api.badResponse(w, r, err.Error())
+		return
 	}
+	subscriptionCount := rooms[channelName]
 	result := map[string]any{
 		"subscription_count": subscriptionCount,
 		"occupied":           subscriptionCount > 0,
@@ -197,7 +242,7 @@ func (api *HttpApi) GetChannelUsers(w http.ResponseWriter, r *http.Request, rout
 		return
 	}
 
-	users := []uint64{}
+	users := []types.UserId{}
 	for _, member := range members.Unique(false) {
 		users = append(users, member.UserId)
 	}
@@ -217,6 +262,20 @@ func (api *HttpApi) GetChannelUsers(w http.ResponseWriter, r *http.Request, rout
 	w.Write(data)
 }
 
+// Forget the cached auth responses of a user.
+func (api *HttpApi) DeleteUserAuthCache(w http.ResponseWriter, r *http.Request, router httprouter.Params) {
+	if err := api.channel.Private.ForgetUser(router.ByName("userId")); err != nil {
+		if api.options.DevMode {
+			utils.Log().Error("%v", err)
+		}
+		api.badResponse(w, r, err.Error())
+		return
+	}
+	w.Header().Add("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, `{}`)
+}
+
 // Handle bad Request.
 func (api *HttpApi) badResponse(w http.ResponseWriter, r *http.Request, message string) {
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
@@ -0,0 +1,19 @@
+package cache
+
+import (
+	"time"
+)
+
+type CacheDriver interface {
+
+	// Get a cached value, nil if missing or expired.
+	Get(string) ([]byte, error)
+
+	// Cache a value of a user for the given time.
+	Set(string, []byte, string, time.Duration) error
+
+	// Forget the values of a user.
+	Forget(string) error
+
+	Close() error
+}
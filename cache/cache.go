@@ -0,0 +1,18 @@
+package cache
+
+import (
+	"errors"
+
+	"github.com/larisgo/laravel-echo-server/options"
+)
+
+// Create a new cache instance.
+func NewCache(_options *options.Config) (CacheDriver, error) {
+	switch _options.AuthCache.Driver {
+	case "memory":
+		return NewMemoryCache(_options), nil
+	case "redis":
+		return NewRedisCache(_options)
+	}
+	return nil, errors.New("The cache driver is not set or the cache driver is invalid.")
+}
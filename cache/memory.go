@@ -0,0 +1,123 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/larisgo/laravel-echo-server/options"
+)
+
+// How often the expired values are dropped.
+const purgeInterval = time.Minute
+
+type memoryItem struct {
+	value   []byte
+	user    string
+	expires time.Time
+}
+
+type MemoryCache struct {
+
+	// Cached values by key.
+	items map[string]*memoryItem
+
+	// Keys of the values of each user.
+	users map[string]map[string]struct{}
+
+	mu sync.Mutex
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// Create a new cache instance.
+func NewMemoryCache(_options *options.Config) CacheDriver {
+	c := &MemoryCache{}
+	c.items = map[string]*memoryItem{}
+	c.users = map[string]map[string]struct{}{}
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	go c.purge()
+	return c
+}
+
+func (c *MemoryCache) Close() error {
+	c.cancel()
+	return nil
+}
+
+// Retrieve a value from memory.
+func (c *MemoryCache) Get(key string) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	item, ok := c.items[key]
+	if !ok || time.Now().After(item.expires) {
+		return nil, nil
+	}
+	return item.value, nil
+}
+
+// Store a value to memory.
+func (c *MemoryCache) Set(key string, value []byte, user string, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.remove(key)
+	c.items[key] = &memoryItem{value: value, user: user, expires: time.Now().Add(ttl)}
+	if user != "" {
+		if _, ok := c.users[user]; !ok {
+			c.users[user] = map[string]struct{}{}
+		}
+		c.users[user][key] = struct{}{}
+	}
+	return nil
+}
+
+// Forget the values of a user.
+func (c *MemoryCache) Forget(user string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key := range c.users[user] {
+		delete(c.items, key)
+	}
+	delete(c.users, user)
+	return nil
+}
+
+// Remove a value and its user index, the lock must be held.
+func (c *MemoryCache) remove(key string) {
+	item, ok := c.items[key]
+	if !ok {
+		return
+	}
+	delete(c.items, key)
+	if keys, ok := c.users[item.user]; ok {
+		delete(keys, key)
+		if len(keys) == 0 {
+			delete(c.users, item.user)
+		}
+	}
+}
+
+// Drop the expired values periodically.
+func (c *MemoryCache) purge() {
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case now := <-ticker.C:
+			c.mu.Lock()
+			for key, item := range c.items {
+				if now.After(item.expires) {
+					c.remove(key)
+				}
+			}
+			c.mu.Unlock()
+		}
+	}
+}
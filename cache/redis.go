@@ -0,0 +1,92 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/larisgo/laravel-echo-server/database"
+	"github.com/larisgo/laravel-echo-server/options"
+)
+
+// Prefix of the keys of the cached values.
+const keyPrefix = "laravel-echo-server#cache:"
+
+// Prefix of the keys of the sets of keys of each user.
+const userKeyPrefix = "laravel-echo-server#cache-user:"
+
+type RedisCache struct {
+
+	// Redis client.
+	redis redis.UniversalClient
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// Create a new cache instance.
+func NewRedisCache(_options *options.Config) (CacheDriver, error) {
+	c := &RedisCache{}
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	client, err := database.NewRedisClient(_options)
+	if err != nil {
+		return nil, err
+	}
+	c.redis = client
+	return c, nil
+}
+
+func (c *RedisCache) Close() error {
+	c.cancel()
+	return database.ReleaseRedisClient()
+}
+
+// Retrieve a value from redis.
+func (c *RedisCache) Get(key string) ([]byte, error) {
+	data, err := c.redis.Get(c.ctx, keyPrefix+key).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+// Store a value to redis and index it by its user, the index lives as long as
+// its longest value. The keys may live on different cluster nodes, so they are
+// updated by separate commands.
+func (c *RedisCache) Set(key string, value []byte, user string, ttl time.Duration) error {
+	if user == "" {
+		return c.redis.Set(c.ctx, keyPrefix+key, value, ttl).Err()
+	}
+	index := userKeyPrefix + user
+
+	pipe := c.redis.Pipeline()
+	pipe.Set(c.ctx, keyPrefix+key, value, ttl)
+	pipe.SAdd(c.ctx, index, keyPrefix+key)
+	pttl := pipe.PTTL(c.ctx, index)
+	if _, err := pipe.Exec(c.ctx); err != nil {
+		return err
+	}
+	if pttl.Val() < ttl {
+		return c.redis.PExpire(c.ctx, index, ttl).Err()
+	}
+	return nil
+}
+
+// Forget the values of a user and its index.
+func (c *RedisCache) Forget(user string) error {
+	index := userKeyPrefix + user
+	keys, err := c.redis.SMembers(c.ctx, index).Result()
+	if err != nil {
+		return err
+	}
+	pipe := c.redis.Pipeline()
+	for _, key := range keys {
+		pipe.Del(c.ctx, key)
+	}
+	pipe.Del(c.ctx, index)
+	_, err = pipe.Exec(c.ctx)
+	return err
+}
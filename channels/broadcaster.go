@@ -0,0 +1,230 @@
+package channels
+
+import (
+	"hash/fnv"
+	"sync"
+
+	"github.com/larisgo/laravel-echo-server/adapters"
+	"github.com/larisgo/laravel-echo-server/options"
+	"github.com/zishang520/engine.io/types"
+	"github.com/zishang520/socket.io/socket"
+)
+
+// A connection server, other than Socket.io, whose connections subscribe to channels.
+type Transport interface {
+	// Emit an event to the connections of a channel, except the given connection id, with its history sequence unless zero.
+	Emit(string, string, any, string, int64) error
+
+	// Get the ids of the connections subscribed to a channel.
+	Clients(string) []string
+
+	// Get the open channels and their subscription count.
+	Channels() map[string]int
+
+	// Get the number of open connections.
+	Count() int
+}
+
+type Broadcaster struct {
+
+	// Socket.io client.
+	io *socket.Server
+
+	// Additional transports.
+	transports []Transport
+
+	// Cluster adapter, relays to the other server nodes.
+	adapter adapters.Adapter
+
+	// Order the numbered events of a channel with the replay of its history, striped by channel.
+	locks [64]sync.Mutex
+
+	// Guards the transports, held while emitting so that the recovery can hold the broadcasts.
+	mu sync.RWMutex
+}
+
+// Create a new broadcaster instance.
+func NewBroadcaster(io *socket.Server, _options *options.Config) (b *Broadcaster, err error) {
+	b = &Broadcaster{}
+	b.io = io
+	b.transports = []Transport{}
+	b.adapter, err = adapters.NewAdapter(b, _options)
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (b *Broadcaster) Close() error {
+	return b.adapter.Close()
+}
+
+// Register an additional transport.
+func (b *Broadcaster) AddTransport(transport Transport) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.transports = append(b.transports, transport)
+}
+
+// Emit an event to all connections of a channel in the cluster, except the given connection id.
+func (b *Broadcaster) Emit(channel string, event string, data any, except string) error {
+	return b.EmitSequenced(channel, event, data, except, 0)
+}
+
+// Emit an event numbered in the history of its channel to all connections of the channel in the cluster.
+func (b *Broadcaster) EmitSequenced(channel string, event string, data any, except string, seq int64) error {
+	err := b.EmitLocal(channel, event, data, except, seq)
+	if e := b.adapter.Publish(channel, event, data, except, seq); e != nil && err == nil {
+		err = e
+	}
+	return err
+}
+
+// Emit an event numbered in the history of its channel to the cluster, with the lock of the
+// channel held by the caller.
+func (b *Broadcaster) emitLocked(channel string, event string, data any, except string, seq int64) error {
+	err := b.emit(channel, event, data, except, seq)
+	if e := b.adapter.Publish(channel, event, data, except, seq); e != nil && err == nil {
+		err = e
+	}
+	return err
+}
+
+// Emit an event to the connections of a channel on this node, except the given connection id,
+// Socket.io clients get the history sequence as an extra argument.
+func (b *Broadcaster) EmitLocal(channel string, event string, data any, except string, seq int64) error {
+	if seq > 0 {
+		lock := b.lock(channel)
+		lock.Lock()
+		defer lock.Unlock()
+	}
+	return b.emit(channel, event, data, except, seq)
+}
+
+// Emit an event to the connections of a channel on this node.
+func (b *Broadcaster) emit(channel string, event string, data any, except string, seq int64) (err error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	// Without a Socket.io server, the other transports are the only connections.
+	if b.io != nil {
+		operator := b.io.To(socket.Room(channel))
+		if except != "" {
+			operator = operator.Except(socket.Room(except))
+		}
+		if seq > 0 {
+			err = operator.Emit(event, channel, data, &Sequence{Seq: seq})
+		} else {
+			err = operator.Emit(event, channel, data)
+		}
+	}
+
+	for _, transport := range b.transports {
+		if e := transport.Emit(channel, event, data, except, seq); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// Get the lock ordering the numbered events of a channel.
+func (b *Broadcaster) lock(channel string) *sync.Mutex {
+	h := fnv.New32a()
+	h.Write([]byte(channel))
+	return &b.locks[h.Sum32()%uint32(len(b.locks))]
+}
+
+// Get the ids of all connections subscribed to a channel in the cluster.
+func (b *Broadcaster) Clients(channel string) (*types.Set[string], error) {
+	local, err := b.LocalClients(channel)
+	if err != nil {
+		return nil, err
+	}
+	remote, err := b.adapter.Clients(channel)
+	if err != nil {
+		return nil, err
+	}
+	return types.NewSet(append(local, remote...)...), nil
+}
+
+// Get the ids of the connections subscribed to a channel on this node.
+func (b *Broadcaster) LocalClients(channel string) ([]string, error) {
+	clients := []string{}
+	if b.io != nil {
+		sockets, err := b.io.Sockets().In(socket.Room(channel)).AllSockets()
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range sockets.Keys() {
+			clients = append(clients, string(id))
+		}
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for _, transport := range b.transports {
+		clients = append(clients, transport.Clients(channel)...)
+	}
+	return clients, nil
+}
+
+// Get all open channels in the cluster and their subscription count.
+func (b *Broadcaster) Channels() (map[string]int, error) {
+	channels, err := b.adapter.Channels()
+	if err != nil {
+		return nil, err
+	}
+	for channel, count := range b.LocalChannels() {
+		channels[channel] += count
+	}
+	return channels, nil
+}
+
+// Get the open channels on this node and their subscription count.
+func (b *Broadcaster) LocalChannels() map[string]int {
+	channels := map[string]int{}
+	b.io.Sockets().Adapter().Rooms().Range(func(room, sockets any) bool {
+		channel := room.(socket.Room)
+		ss := sockets.(*types.Set[socket.SocketId])
+		// Skip the private room of each socket.
+		if ss.Has(socket.SocketId(channel)) {
+			return true
+		}
+		channels[string(channel)] += ss.Len()
+		return true
+	})
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for _, transport := range b.transports {
+		for channel, count := range transport.Channels() {
+			channels[channel] += count
+		}
+	}
+	return channels
+}
+
+// Get the number of open connections in the cluster.
+func (b *Broadcaster) Count() (int, error) {
+	count, err := b.adapter.Count()
+	if err != nil {
+		return 0, err
+	}
+	return count + b.LocalCount(), nil
+}
+
+// Get the number of open connections on this node.
+func (b *Broadcaster) LocalCount() int {
+	count := int(b.io.Engine().ClientsCount())
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for _, transport := range b.transports {
+		count += transport.Count()
+	}
+	return count
+}
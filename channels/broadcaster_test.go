@@ -0,0 +1,104 @@
+package channels
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/larisgo/laravel-echo-server/options"
+)
+
+// An adapter relaying to a single other node.
+type peerAdapter struct {
+	peer *Broadcaster
+}
+
+func (a *peerAdapter) Publish(channel string, event string, data any, except string, seq int64) error {
+	return a.peer.EmitLocal(channel, event, data, except, seq)
+}
+
+func (a *peerAdapter) Clients(string) ([]string, error) { return []string{}, nil }
+
+func (a *peerAdapter) Channels() (map[string]int, error) { return map[string]int{}, nil }
+
+func (a *peerAdapter) Count() (int, error) { return 0, nil }
+
+func (a *peerAdapter) Close() error { return nil }
+
+// A transport recording the events emitted to its connections.
+type recordingTransport struct {
+	events  map[string]int
+	clients map[string][]string
+	mu      sync.Mutex
+}
+
+func (r *recordingTransport) Emit(channel string, event string, data any, except string, seq int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events[channel+":"+event]++
+	return nil
+}
+
+func (r *recordingTransport) Clients(channel string) []string { return r.clients[channel] }
+
+func (r *recordingTransport) Channels() map[string]int { return map[string]int{} }
+
+func (r *recordingTransport) Count() int { return 0 }
+
+type testNode struct {
+	history   *HistoryChannel
+	transport *recordingTransport
+}
+
+// Create two server nodes relaying to each other.
+func newTestNodes(t *testing.T) (*testNode, *testNode) {
+	t.Helper()
+	a, b := &Broadcaster{}, &Broadcaster{}
+	a.adapter, b.adapter = &peerAdapter{peer: b}, &peerAdapter{peer: a}
+
+	nodes := []*testNode{}
+	for _, broadcaster := range []*Broadcaster{a, b} {
+		_options := &options.Config{}
+		_options.History = options.History{Enabled: true, Driver: "memory", Channels: []string{"orders*"}, Size: 10}
+		hch, err := NewHistoryChannel(broadcaster, _options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { hch.Close() })
+		transport := &recordingTransport{events: map[string]int{}}
+		broadcaster.AddTransport(transport)
+		nodes = append(nodes, &testNode{history: hch, transport: transport})
+	}
+	return nodes[0], nodes[1]
+}
+
+func TestSingleNodeEventsAreRelayedOnce(t *testing.T) {
+	for _, channel := range []string{"news", "orders"} {
+		a, b := newTestNodes(t)
+		// An event of the HTTP API reaches a single node.
+		if err := a.history.Emit(channel, "Updated", "{}", ""); err != nil {
+			t.Fatal(err)
+		}
+		for i, node := range []*testNode{a, b} {
+			if count := node.transport.events[channel+":Updated"]; count != 1 {
+				t.Errorf("%s: node %d got the event %d times", channel, i, count)
+			}
+		}
+	}
+}
+
+func TestFanOutEventsAreNotRelayed(t *testing.T) {
+	for _, channel := range []string{"news", "orders"} {
+		a, b := newTestNodes(t)
+		// An event of a Redis channel reaches every node.
+		for _, node := range []*testNode{a, b} {
+			if err := node.history.EmitLocal(channel, "Updated", "{}", ""); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for i, node := range []*testNode{a, b} {
+			if count := node.transport.events[channel+":Updated"]; count != 1 {
+				t.Errorf("%s: node %d got the event %d times", channel, i, count)
+			}
+		}
+	}
+}
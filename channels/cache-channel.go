@@ -0,0 +1,77 @@
+package channels
+
+import (
+	"strings"
+	"time"
+
+	"github.com/larisgo/laravel-echo-server/database"
+	"github.com/larisgo/laravel-echo-server/options"
+	"github.com/larisgo/laravel-echo-server/types"
+	"github.com/zishang520/engine.io/utils"
+)
+
+// Prefixes of the cache channels, which send their last event to new subscribers.
+var cachePrefixes = []string{"cache-", "private-cache-", "presence-cache-", "private-encrypted-cache-"}
+
+type CacheChannel struct {
+
+	// Database instance, storing the last events.
+	db database.DatabaseDriver
+
+	// Configurable server options.
+	options *options.Config
+}
+
+// Create a new cache channel instance.
+func NewCacheChannel(_options *options.Config) (cch *CacheChannel, err error) {
+	cch = &CacheChannel{}
+	cch.options = _options
+	cch.db, err = database.NewDatabase(_options)
+	if err != nil {
+		return nil, err
+	}
+	return cch, nil
+}
+
+func (cch *CacheChannel) Close() error {
+	return cch.db.Close()
+}
+
+// Check if a channel is a cache channel.
+func (cch *CacheChannel) IsCache(channel string) bool {
+	for _, prefix := range cachePrefixes {
+		if strings.HasPrefix(channel, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Store the event broadcast on a cache channel, replacing the previous one.
+func (cch *CacheChannel) Store(channel string, message *types.Data) error {
+	if !cch.IsCache(channel) {
+		return nil
+	}
+	return cch.db.SetLastEvent(channel, &types.Data{
+		Channel: channel,
+		Event:   message.Event,
+		Data:    message.Data,
+	}, time.Duration(cch.options.Channels.CacheTtl)*time.Second)
+}
+
+// Send the last event of a cache channel to a new subscriber, or a cache_miss
+// event if there is none.
+func (cch *CacheChannel) OnSubscribed(client Client, channel string) {
+	message, err := cch.db.GetLastEvent(channel)
+	if err != nil {
+		if cch.options.DevMode {
+			utils.Log().Error("%v", err)
+		}
+		return
+	}
+	if message == nil {
+		client.Emit("cache_miss", channel, nil)
+		return
+	}
+	client.Emit(message.Event, channel, message.Data)
+}
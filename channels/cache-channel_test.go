@@ -0,0 +1,68 @@
+package channels
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/larisgo/laravel-echo-server/types"
+)
+
+func TestCacheReplaysLastEvent(t *testing.T) {
+	ch := newTestChannel(t, http.StatusOK, `true`)
+	for _, version := range []int{1, 2} {
+		if err := ch.Cache.Store("cache-dashboard", &types.Data{Event: "Updated", Data: map[string]any{"version": version}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ch.Cache.Store("dashboard", &types.Data{Event: "Updated", Data: map[string]any{}}); err != nil {
+		t.Fatal(err)
+	}
+
+	client := newTestClient("1.1")
+	ch.Join(client, &types.Data{Channel: "cache-dashboard"})
+	ch.Join(client, &types.Data{Channel: "dashboard"})
+	if len(client.events) != 1 || client.events[0].event != "Updated" || client.events[0].channel != "cache-dashboard" {
+		t.Fatalf("unexpected events %v", client.received())
+	}
+	if data := client.events[0].data.(map[string]any); data["version"] != float64(2) {
+		t.Fatalf("the last event is not the one replayed, got %v", data)
+	}
+}
+
+func TestCacheMiss(t *testing.T) {
+	ch := newTestChannel(t, http.StatusOK, `true`)
+	if err := ch.Cache.db.SetLastEvent("cache-expired", &types.Data{Channel: "cache-expired", Event: "Updated"}, 10*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	client := newTestClient("1.1")
+	ch.Join(client, &types.Data{Channel: "cache-empty"})
+	ch.Join(client, &types.Data{Channel: "cache-expired"})
+	events := client.received()
+	if len(events) != 2 || events[0] != "cache-empty:cache_miss" || events[1] != "cache-expired:cache_miss" {
+		t.Fatalf("unexpected events %v", events)
+	}
+}
+
+func TestPrivateCacheReplaysOnceAuthorized(t *testing.T) {
+	for _, test := range []struct {
+		status int
+		events []string
+	}{
+		{http.StatusOK, []string{"private-cache-orders:Updated"}},
+		{http.StatusForbidden, []string{"private-cache-orders:subscription_error"}},
+	} {
+		ch := newTestChannel(t, test.status, `true`)
+		if err := ch.Cache.Store("private-cache-orders", &types.Data{Event: "Updated", Data: map[string]any{}}); err != nil {
+			t.Fatal(err)
+		}
+		client := newTestClient("1.1")
+		ch.Join(client, &types.Data{Channel: "private-cache-orders"})
+		events := client.received()
+		if len(events) != len(test.events) || events[0] != test.events[0] {
+			t.Fatalf("%d: expected %v, got %v", test.status, test.events, events)
+		}
+	}
+}
@@ -1,22 +1,36 @@
 package channels
 
 import (
+	"encoding/json"
 	"regexp"
 	"strings"
 
 	"github.com/larisgo/laravel-echo-server/options"
 	"github.com/larisgo/laravel-echo-server/types"
+	"github.com/larisgo/laravel-echo-server/webhooks"
 	"github.com/zishang520/engine.io/utils"
 	"github.com/zishang520/socket.io/socket"
 )
 
+// Client events allowed on the channels matching a pattern.
+type clientEventRule struct {
+	channel *regexp.Regexp
+	events  []*regexp.Regexp
+}
+
+// Prefix of the end-to-end encrypted channels, private whatever the patterns.
+const EncryptedPrefix = "private-encrypted-"
+
 type Channel struct {
 
 	// Channels and patters for private channels.
 	privateChannels []*regexp.Regexp
 
+	// Channels and patters for presence channels.
+	presenceChannels []*regexp.Regexp
+
 	// Allowed client events
-	clientEvents []*regexp.Regexp
+	clientEvents []*clientEventRule
 
 	// Private channel instance.
 	Private *PrivateChannel
@@ -24,31 +38,58 @@ type Channel struct {
 	// Presence channel instance.
 	Presence *PresenceChannel
 
+	// Cache channel instance.
+	Cache *CacheChannel
+
+	// Keeps the recent events of the channels for the clients resuming.
+	History *HistoryChannel
+
+	// Keeps the channels of the disconnected connections for the clients recovering.
+	Recovery *Recovery
+
+	// Emits events to the connections of every transport.
+	Broadcaster *Broadcaster
+
+	// Reports the channel events to the webhooks.
+	Webhooks *webhooks.Webhooks
+
 	// Configurable server options.
 	options *options.Config
-
-	// Socket.io client.
-	io *socket.Server
 }
 
 // Create a new channel instance.
 func NewChannel(io *socket.Server, _options *options.Config) (ch *Channel, err error) {
 	ch = &Channel{}
 
-	ch.io = io
 	ch.options = _options
-
-	ch.privateChannels = []*regexp.Regexp{
-		regexp.MustCompile(strings.ReplaceAll(regexp.QuoteMeta(`private-*`), `\*`, `.*`)),
-		regexp.MustCompile(strings.ReplaceAll(regexp.QuoteMeta(`presence-*`), `\*`, `.*`)),
+	ch.Broadcaster, err = NewBroadcaster(io, ch.options)
+	if err != nil {
+		return nil, err
 	}
 
-	ch.clientEvents = []*regexp.Regexp{
-		regexp.MustCompile(strings.ReplaceAll(regexp.QuoteMeta(`client-*`), `\*`, `.*`)),
-	}
+	ch.compileRules(ch.options.Channels)
 
-	ch.Private = NewPrivateChannel(ch.options)
-	ch.Presence, err = NewPresenceChannel(io, ch.options)
+	ch.Private, err = NewPrivateChannel(ch.options)
+	if err != nil {
+		return nil, err
+	}
+	ch.Webhooks, err = webhooks.NewWebhooks(ch.options)
+	if err != nil {
+		return nil, err
+	}
+	ch.Presence, err = NewPresenceChannel(ch.Broadcaster, ch.Webhooks, ch.options)
+	if err != nil {
+		return nil, err
+	}
+	ch.Cache, err = NewCacheChannel(ch.options)
+	if err != nil {
+		return nil, err
+	}
+	ch.History, err = NewHistoryChannel(ch.Broadcaster, ch.options)
+	if err != nil {
+		return nil, err
+	}
+	ch.Recovery, err = NewRecovery(ch, ch.options)
 	if err != nil {
 		return nil, err
 	}
@@ -61,96 +102,247 @@ func NewChannel(io *socket.Server, _options *options.Config) (ch *Channel, err e
 }
 
 // Join a channel.
-func (ch *Channel) Join(_socket *socket.Socket, data *types.Data) {
+func (ch *Channel) Join(client Client, data *types.Data) {
 	if data.Channel != "" {
-		if ch.IsPrivate(data.Channel) {
-			ch.JoinPrivate(_socket, data)
+		if ch.Recovery.Enabled() && client.Has(data.Channel) {
+			ch.rejoin(client, data)
+		} else if ch.IsPrivate(data.Channel) {
+			ch.JoinPrivate(client, data)
 		} else {
-			_socket.Join(socket.Room(data.Channel))
-			ch.OnJoin(_socket, data.Channel)
+			ch.subscribe(client, data)
+			ch.OnJoin(client, data.Channel)
 		}
 	}
 }
 
-// Trigger a client message
-func (ch *Channel) ClientEvent(_socket *socket.Socket, data *types.Data) {
+// Trigger a client message, never on encrypted channels as the server cannot
+// tell the payload is encrypted.
+func (ch *Channel) ClientEvent(client Client, data *types.Data) {
 	if data.Event != "" && data.Channel != "" {
-		if ch.IsClientEvent(data.Event) &&
+		if ch.IsEncrypted(data.Channel) {
+			if ch.options.DevMode {
+				utils.Log().Warning(`%s sent the client event %s to the encrypted channel %s`, client.Id(), data.Event, data.Channel)
+			}
+			return
+		}
+		if ch.IsClientEvent(data.Channel, data.Event) &&
 			ch.IsPrivate(data.Channel) &&
-			ch.IsInChannel(_socket, data.Channel) {
-			// ch.io.Sockets().Sockets().Load(_socket.Id())
-			_socket.Broadcast().To(socket.Room(data.Channel)).Emit(data.Event, data.Channel, data.Data)
+			ch.IsInChannel(client, data.Channel) {
+			ch.Broadcaster.Emit(data.Channel, data.Event, data.Data, client.Id())
+			ch.triggerClientEvent(client, data)
 		}
 	}
 }
 
 // Leave a channel.
-func (ch *Channel) Leave(_socket *socket.Socket, channel string, reason string) {
+func (ch *Channel) Leave(client Client, channel string, reason string) {
 	if channel != "" {
 		if ch.IsPresence(channel) {
-			ch.Presence.Leave(_socket, channel)
+			ch.Presence.Leave(client, channel)
 		}
 
-		_socket.Leave(socket.Room(channel))
+		subscribed := client.Has(channel)
+		client.Leave(channel)
+		if subscribed {
+			ch.triggerOccupancy(channel, -1)
+		}
 
 		if ch.options.DevMode {
-			utils.Log().Info(`%s left channel: %s (%s)`, _socket.Id(), channel, reason)
+			utils.Log().Info(`%s left channel: %s (%s)`, client.Id(), channel, reason)
 		}
 	}
 }
 
-// Check if the incoming socket connection is a private channel.
+// Check if the incoming socket connection is a private channel, presence
+// channels are private as well.
 func (ch *Channel) IsPrivate(channel string) bool {
-	for _, privateChannel := range ch.privateChannels {
-		if privateChannel.MatchString(channel) {
-			return true
-		}
-	}
-	return false
+	return matchesAny(ch.privateChannels, channel) || ch.IsPresence(channel) || ch.IsEncrypted(channel)
+}
+
+// Check if a channel is end-to-end encrypted.
+func (ch *Channel) IsEncrypted(channel string) bool {
+	return IsEncrypted(channel)
+}
+
+// Check if a channel is end-to-end encrypted, its events are forwarded as sent.
+func IsEncrypted(channel string) bool {
+	return strings.HasPrefix(channel, EncryptedPrefix)
 }
 
-// Join private channel, emit data to presence channels.
-func (ch *Channel) JoinPrivate(_socket *socket.Socket, data *types.Data) {
-	res, status, err := ch.Private.Authenticate(_socket, data)
+// Join private channel, emit data to presence channels and the shared secret
+// of the auth response to encrypted channels.
+func (ch *Channel) JoinPrivate(client Client, data *types.Data) {
+	res, status, err := ch.Private.Authenticate(client, data, ch.IsPresence(data.Channel))
 	if err != nil {
 		if ch.options.DevMode {
 			utils.Log().Error("%v", err)
 		}
-		_socket.Emit("subscription_error", data.Channel, status)
+		client.Emit("subscription_error", data.Channel, status)
 	} else {
-		_socket.Join(socket.Room(data.Channel))
+		ch.subscribe(client, data)
 		if ch.IsPresence(data.Channel) {
 			if channel_data, is_auth := res.(*types.AuthenticateData); is_auth {
-				ch.Presence.Join(_socket, data.Channel, &channel_data.ChannelData)
+				ch.Presence.Join(client, data.Channel, &channel_data.ChannelData)
 			}
 		}
-		ch.OnJoin(_socket, data.Channel)
+		if ch.IsEncrypted(data.Channel) {
+			// Clients signing their own subscription got the secret with their signature.
+			if auth, is_auth := res.(*types.AuthenticateData); is_auth && auth.SharedSecret != "" {
+				client.Emit("encrypted:subscribed", data.Channel, map[string]string{
+					"shared_secret": auth.SharedSecret,
+				})
+			}
+		}
+		ch.OnJoin(client, data.Channel)
 	}
 }
 
 // Check if a channel is a presence channel.
 func (ch *Channel) IsPresence(channel string) bool {
-	return strings.LastIndex(channel, `presence-`) == 0
+	return matchesAny(ch.presenceChannels, channel)
 }
 
-// On join a channel log success.
-func (ch *Channel) OnJoin(_socket *socket.Socket, channel string) {
+// On join a channel log success, and send the last event of a cache channel.
+func (ch *Channel) OnJoin(client Client, channel string) {
 	if ch.options.DevMode {
-		utils.Log().Info(`%s joined channel: %s`, _socket.Id(), channel)
+		utils.Log().Info(`%s joined channel: %s`, client.Id(), channel)
+	}
+	if ch.Cache.IsCache(channel) {
+		ch.Cache.OnSubscribed(client, channel)
 	}
 }
 
-// Check if client is a client event
-func (ch *Channel) IsClientEvent(event string) bool {
-	for _, clientEvent := range ch.clientEvents {
-		if clientEvent.MatchString(event) {
+// Confirm the subscription of a client subscribing again to a channel, like a recovered
+// connection, without authenticating it again.
+func (ch *Channel) rejoin(client Client, data *types.Data) {
+	ch.History.Join(client, data.Channel, data.Since)
+	if ch.IsPresence(data.Channel) {
+		members, err := ch.Presence.GetMembers(data.Channel)
+		if err != nil {
+			if ch.options.DevMode {
+				utils.Log().Error("%v", err)
+			}
+			return
+		}
+		ch.Presence.OnSubscribed(client, data.Channel, members.Unique(true))
+	}
+	ch.OnJoin(client, data.Channel)
+}
+
+// Subscribe a client to a channel, replaying the events it missed since the given sequence.
+// The first subscription reports the channel occupied.
+func (ch *Channel) subscribe(client Client, data *types.Data) {
+	subscribed := client.Has(data.Channel)
+	ch.History.Join(client, data.Channel, data.Since)
+	if !subscribed {
+		ch.triggerOccupancy(data.Channel, 1)
+	}
+}
+
+// Count a subscriber joining or leaving a channel, reporting it occupied once it has
+// a subscriber and vacated once it has none. The count is shared by every node so
+// only one of them sees each transition.
+func (ch *Channel) triggerOccupancy(channel string, delta int64) {
+	if !ch.Webhooks.Wants(webhooks.ChannelOccupied) && !ch.Webhooks.Wants(webhooks.ChannelVacated) {
+		return
+	}
+	count, err := ch.Webhooks.Occupy(channel, delta)
+	if err != nil {
+		if ch.options.DevMode {
+			utils.Log().Error("%v", err)
+		}
+		return
+	}
+	if delta > 0 && count == 1 {
+		ch.Webhooks.Trigger(&types.WebhookEvent{Name: webhooks.ChannelOccupied, Channel: channel})
+	} else if delta < 0 && count == 0 {
+		ch.Webhooks.Trigger(&types.WebhookEvent{Name: webhooks.ChannelVacated, Channel: channel})
+	}
+}
+
+// Report a client event, with the user who sent it on a presence channel.
+func (ch *Channel) triggerClientEvent(client Client, data *types.Data) {
+	if !ch.Webhooks.Wants(webhooks.ClientEvent) {
+		return
+	}
+	payload, err := json.Marshal(data.Data)
+	if err != nil {
+		if ch.options.DevMode {
+			utils.Log().Error("%v", err)
+		}
+		return
+	}
+	event := &types.WebhookEvent{
+		Name:     webhooks.ClientEvent,
+		Channel:  data.Channel,
+		Event:    data.Event,
+		Data:     string(payload),
+		SocketId: client.Id(),
+	}
+	if ch.IsPresence(data.Channel) {
+		members, err := ch.Presence.GetMembers(data.Channel)
+		if err != nil && ch.options.DevMode {
+			utils.Log().Error("%v", err)
+		}
+		for _, member := range members {
+			if member.SocketId == client.Id() {
+				event.UserId = member.UserId.String()
+				break
+			}
+		}
+	}
+	ch.Webhooks.Trigger(event)
+}
+
+// Check if client is a client event allowed on the channel
+func (ch *Channel) IsClientEvent(channel string, event string) bool {
+	for _, rule := range ch.clientEvents {
+		if rule.channel.MatchString(channel) && matchesAny(rule.events, event) {
 			return true
 		}
 	}
 	return false
 }
 
-// Check if a socket has joined a channel.
-func (ch *Channel) IsInChannel(_socket *socket.Socket, channel string) bool {
-	return _socket.Rooms().Has(socket.Room(channel))
+// Compile the patterns of the private and presence channels and of the client events.
+func (ch *Channel) compileRules(config options.Channels) {
+	ch.privateChannels = globs(config.Private)
+	ch.presenceChannels = globs(config.Presence)
+
+	ch.clientEvents = []*clientEventRule{}
+	for _, rule := range config.ClientEvents {
+		ch.clientEvents = append(ch.clientEvents, &clientEventRule{
+			channel: glob(rule.Channel),
+			events:  globs(rule.Events),
+		})
+	}
+}
+
+// Check if a client has joined a channel.
+func (ch *Channel) IsInChannel(client Client, channel string) bool {
+	return client.Has(channel)
+}
+
+// Compile a glob pattern, where "*" matches any characters, to match whole names.
+func glob(pattern string) *regexp.Regexp {
+	return regexp.MustCompile(`^` + strings.ReplaceAll(regexp.QuoteMeta(pattern), `\*`, `.*`) + `$`)
+}
+
+// Compile a list of glob patterns.
+func globs(patterns []string) []*regexp.Regexp {
+	result := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		result = append(result, glob(pattern))
+	}
+	return result
+}
+
+// Check if a name matches any of the patterns.
+func matchesAny(patterns []*regexp.Regexp, name string) bool {
+	for _, pattern := range patterns {
+		if pattern.MatchString(name) {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,249 @@
+package channels
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/larisgo/laravel-echo-server/options"
+	"github.com/larisgo/laravel-echo-server/types"
+)
+
+// Create the channels of a server without Socket.io, storing in a temporary SQLite
+// database, whose auth endpoint answers with the given status and body.
+func newTestChannel(t *testing.T, status int, body string) *Channel {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+
+	_options := &options.Config{}
+	_options.AuthHost = server.URL
+	_options.AuthEndpoint = "/broadcasting/auth"
+	_options.Database = "sqlite"
+	_options.DatabaseConfig.Sqlite.DatabasePath = t.TempDir() + "/database.sqlite"
+	_options.Channels = options.Channels{
+		Private:      []string{"private-*"},
+		Presence:     []string{"presence-*"},
+		ClientEvents: []options.ClientEventRule{{Channel: "*", Events: []string{"client-*"}}},
+		CacheTtl:     60,
+	}
+	ch, err := NewChannel(nil, _options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		ch.Recovery.Close()
+		ch.Private.Close()
+		ch.Presence.Close()
+		ch.Webhooks.Close()
+		ch.Cache.Close()
+		ch.History.Close()
+		ch.Broadcaster.Close()
+	})
+	return ch
+}
+
+// Get the events of a client, as channel:event.
+func (client *testClient) received() []string {
+	events := []string{}
+	for _, e := range client.events {
+		events = append(events, e.channel+":"+e.event)
+	}
+	return events
+}
+
+func TestGlob(t *testing.T) {
+	for _, test := range []struct {
+		pattern string
+		name    string
+		matches bool
+	}{
+		{"private-*", "private-orders", true},
+		{"private-*", "private-", true},
+		{"private-*", "xprivate-orders", false},
+		{"*-admin", "orders-admin", true},
+		{"*-admin", "orders-admin-2", false},
+		{"orders.*.items", "orders.1.items", true},
+		{"orders.*.items", "orders1items", false},
+		{"App.User.*", "App.User.1", true},
+		{"App.User.*", "AppxUserx1", false},
+		{"(a|b)+", "(a|b)+", true},
+		{"(a|b)+", "ab", false},
+		{"*", "", true},
+		{"orders", "orders", true},
+		{"orders", "orders-1", false},
+	} {
+		if matches := glob(test.pattern).MatchString(test.name); matches != test.matches {
+			t.Errorf("%q matching %q: %v, expected %v", test.pattern, test.name, matches, test.matches)
+		}
+	}
+}
+
+func TestDefaultRules(t *testing.T) {
+	ch := &Channel{}
+	ch.compileRules(options.Channels{
+		Private:      []string{"private-*"},
+		Presence:     []string{"presence-*"},
+		ClientEvents: []options.ClientEventRule{{Channel: "*", Events: []string{"client-*"}}},
+	})
+
+	if !ch.IsPrivate("private-orders") || ch.IsPrivate("orders") {
+		t.Error("the private channels do not default to private-*")
+	}
+	if !ch.IsPresence("presence-chat") || !ch.IsPrivate("presence-chat") || ch.IsPresence("private-chat") {
+		t.Error("the presence channels do not default to presence-*")
+	}
+	if !ch.IsPrivate("private-encrypted-orders") {
+		t.Error("the encrypted channels are not private")
+	}
+	if !ch.IsClientEvent("private-chat", "client-typing") || ch.IsClientEvent("private-chat", "typing") {
+		t.Error("the client events do not default to client-*")
+	}
+}
+
+func TestConfiguredRules(t *testing.T) {
+	ch := &Channel{}
+	ch.compileRules(options.Channels{
+		Private:  []string{"App.User.*", "admin"},
+		Presence: []string{"room.*"},
+		ClientEvents: []options.ClientEventRule{
+			{Channel: "room.*", Events: []string{"typing", "whisper-*"}},
+		},
+	})
+
+	if !ch.IsPrivate("App.User.1") || !ch.IsPrivate("admin") || ch.IsPrivate("private-orders") {
+		t.Error("the private channels do not follow the patterns")
+	}
+	if !ch.IsPresence("room.1") || !ch.IsPrivate("room.1") || ch.IsPresence("presence-chat") {
+		t.Error("the presence channels do not follow the patterns")
+	}
+	if !ch.IsClientEvent("room.1", "typing") || !ch.IsClientEvent("room.1", "whisper-hello") {
+		t.Error("the allowed client events are refused")
+	}
+	if ch.IsClientEvent("room.1", "client-typing") || ch.IsClientEvent("App.User.1", "typing") {
+		t.Error("a client event outside the rules is allowed")
+	}
+}
+
+func TestEmptyRules(t *testing.T) {
+	ch := &Channel{}
+	ch.compileRules(options.Channels{Private: []string{}, Presence: []string{}, ClientEvents: []options.ClientEventRule{}})
+
+	if ch.IsPrivate("private-orders") || ch.IsPresence("presence-chat") {
+		t.Error("an empty list of patterns keeps the default")
+	}
+	if !ch.IsPrivate("private-encrypted-orders") {
+		t.Error("the encrypted channels are not private without patterns")
+	}
+	if ch.IsClientEvent("private-chat", "client-typing") {
+		t.Error("an empty list of client events keeps the default")
+	}
+}
+
+// A connection recording the events it receives.
+type testClient struct {
+	id       string
+	channels map[string]bool
+	signs    bool
+	app      options.Client
+	events   []testEvent
+}
+
+type testEvent struct {
+	event   string
+	channel string
+	data    any
+	seq     int64
+}
+
+func newTestClient(id string) *testClient {
+	return &testClient{id: id, channels: map[string]bool{}}
+}
+
+func (client *testClient) Id() string {
+	return client.id
+}
+
+func (client *testClient) Header(key string) string {
+	return ""
+}
+
+func (client *testClient) Join(channel string) {
+	client.channels[channel] = true
+}
+
+func (client *testClient) Leave(channel string) {
+	delete(client.channels, channel)
+}
+
+func (client *testClient) Has(channel string) bool {
+	return client.channels[channel]
+}
+
+func (client *testClient) Emit(event string, channel string, data any) error {
+	client.events = append(client.events, testEvent{event, channel, data, 0})
+	return nil
+}
+
+func (client *testClient) EmitSequenced(event string, channel string, data any, seq int64) error {
+	client.events = append(client.events, testEvent{event, channel, data, seq})
+	return nil
+}
+
+func (client *testClient) SignsChannels() bool {
+	return client.signs
+}
+
+func (client *testClient) App() options.Client {
+	return client.app
+}
+
+func TestEncryptedSubscriptionRefused(t *testing.T) {
+	ch := newTestChannel(t, http.StatusForbidden, `{"message":"Forbidden"}`)
+	client := newTestClient("1.1")
+	ch.Join(client, &types.Data{Channel: "private-encrypted-orders"})
+
+	if client.Has("private-encrypted-orders") {
+		t.Fatal("a refused connection joined the encrypted channel")
+	}
+	if len(client.events) != 1 || client.events[0].event != "subscription_error" || client.events[0].data != http.StatusForbidden {
+		t.Fatalf("unexpected events %v", client.events)
+	}
+}
+
+func TestEncryptedSubscriptionAllowed(t *testing.T) {
+	ch := newTestChannel(t, http.StatusOK, `{"auth":"key:signature","shared_secret":"c2VjcmV0"}`)
+	client := newTestClient("1.1")
+	ch.Join(client, &types.Data{Channel: "private-encrypted-orders"})
+
+	if !client.Has("private-encrypted-orders") {
+		t.Fatal("the authorized connection did not join the encrypted channel")
+	}
+	if len(client.events) != 1 || client.events[0].event != "encrypted:subscribed" {
+		t.Fatalf("unexpected events %v", client.received())
+	}
+	if secret := client.events[0].data.(map[string]string)["shared_secret"]; secret != "c2VjcmV0" {
+		t.Fatalf("the shared secret of the auth response is not sent, got %q", secret)
+	}
+}
+
+func TestEncryptedClientEventsRefused(t *testing.T) {
+	ch := newTestChannel(t, http.StatusOK, `{"auth":"key:signature","shared_secret":"c2VjcmV0"}`)
+	transport := &recordingTransport{events: map[string]int{}}
+	ch.Broadcaster.AddTransport(transport)
+	client := newTestClient("1.1")
+	ch.Join(client, &types.Data{Channel: "private-encrypted-orders"})
+	ch.Join(client, &types.Data{Channel: "private-orders"})
+
+	ch.ClientEvent(client, &types.Data{Channel: "private-encrypted-orders", Event: "client-typing", Data: map[string]any{}})
+	ch.ClientEvent(client, &types.Data{Channel: "private-orders", Event: "client-typing", Data: map[string]any{}})
+	if transport.events["private-encrypted-orders:client-typing"] != 0 {
+		t.Fatal("a client event is sent to an encrypted channel")
+	}
+	if transport.events["private-orders:client-typing"] != 1 {
+		t.Fatal("the client event of a private channel is not sent")
+	}
+}
@@ -0,0 +1,88 @@
+package channels
+
+import (
+	"github.com/larisgo/laravel-echo-server/options"
+	"github.com/zishang520/socket.io/socket"
+)
+
+// A connection that can subscribe to channels.
+type Client interface {
+	// Get the id of the connection.
+	Id() string
+
+	// Get a header of the connection request.
+	Header(string) string
+
+	// Subscribe the connection to a channel.
+	Join(string)
+
+	// Unsubscribe the connection from a channel.
+	Leave(string)
+
+	// Check if the connection has joined a channel.
+	Has(string) bool
+
+	// Emit an event of a channel to the connection.
+	Emit(string, string, any) error
+
+	// Emit an event of a channel numbered in its history to the connection.
+	EmitSequenced(string, string, any, int64) error
+}
+
+// A connection whose private subscriptions are signed with the secret of an API client,
+// like a Pusher protocol connection. The signature is verified whatever the localAuth option.
+type SigningClient interface {
+	Client
+
+	// Check if the subscriptions must be signed.
+	SignsChannels() bool
+
+	// Get the API client of the app the connection belongs to, whose secret signs the subscriptions.
+	App() options.Client
+}
+
+// The history sequence of an event, sent after its data.
+type Sequence struct {
+	Seq int64 `json:"seq"`
+}
+
+type SocketClient struct {
+
+	// Socket.io socket.
+	socket *socket.Socket
+}
+
+// Create a new client for a Socket.io socket.
+func NewSocketClient(_socket *socket.Socket) *SocketClient {
+	client := &SocketClient{}
+	client.socket = _socket
+	return client
+}
+
+func (client *SocketClient) Id() string {
+	return string(client.socket.Id())
+}
+
+func (client *SocketClient) Header(key string) string {
+	return client.socket.Request().Headers().Peek(key)
+}
+
+func (client *SocketClient) Join(channel string) {
+	client.socket.Join(socket.Room(channel))
+}
+
+func (client *SocketClient) Leave(channel string) {
+	client.socket.Leave(socket.Room(channel))
+}
+
+func (client *SocketClient) Has(channel string) bool {
+	return client.socket.Rooms().Has(socket.Room(channel))
+}
+
+func (client *SocketClient) Emit(event string, channel string, data any) error {
+	return client.socket.Emit(event, channel, data)
+}
+
+func (client *SocketClient) EmitSequenced(event string, channel string, data any, seq int64) error {
+	return client.socket.Emit(event, channel, data, &Sequence{Seq: seq})
+}
@@ -0,0 +1,128 @@
+package channels
+
+import (
+	"regexp"
+
+	"github.com/larisgo/laravel-echo-server/history"
+	"github.com/larisgo/laravel-echo-server/options"
+	"github.com/larisgo/laravel-echo-server/types"
+	"github.com/zishang520/engine.io/utils"
+)
+
+type HistoryChannel struct {
+
+	// History of the recent events by channel, nil unless enabled.
+	history history.HistoryDriver
+
+	// Emits the numbered events.
+	broadcaster *Broadcaster
+
+	// Channels and patterns of the channels with a history.
+	channels []*regexp.Regexp
+
+	// Configurable server options.
+	options *options.Config
+}
+
+// Create a new history channel instance, keeping no history unless enabled.
+func NewHistoryChannel(broadcaster *Broadcaster, _options *options.Config) (hch *HistoryChannel, err error) {
+	hch = &HistoryChannel{}
+	hch.broadcaster = broadcaster
+	hch.options = _options
+	if !_options.History.Enabled {
+		return hch, nil
+	}
+	hch.channels = globs(_options.History.Channels)
+	hch.history, err = history.NewHistory(_options)
+	if err != nil {
+		return nil, err
+	}
+	return hch, nil
+}
+
+func (hch *HistoryChannel) Close() error {
+	if hch.history != nil {
+		return hch.history.Close()
+	}
+	return nil
+}
+
+// Check if the events of a channel are kept in a history.
+func (hch *HistoryChannel) IsHistory(channel string) bool {
+	return hch.history != nil && matchesAny(hch.channels, channel)
+}
+
+// Emit an event to a channel in the cluster, numbered and kept in the history of the channel.
+func (hch *HistoryChannel) Emit(channel string, event string, data any, except string) error {
+	return hch.emit(channel, event, data, except, true)
+}
+
+// Emit an event that every node of the cluster receives to the connections of this node,
+// numbered and kept in the history of the channel.
+func (hch *HistoryChannel) EmitLocal(channel string, event string, data any, except string) error {
+	return hch.emit(channel, event, data, except, false)
+}
+
+// The lock of the channel is held from the numbering to the emit, so the events of this node
+// leave in order and a subscriber gets each of them either replayed or live, not both.
+func (hch *HistoryChannel) emit(channel string, event string, data any, except string, relay bool) error {
+	if !hch.IsHistory(channel) {
+		if relay {
+			return hch.broadcaster.Emit(channel, event, data, except)
+		}
+		return hch.broadcaster.EmitLocal(channel, event, data, except, 0)
+	}
+
+	lock := hch.broadcaster.lock(channel)
+	lock.Lock()
+	defer lock.Unlock()
+
+	seq, err := hch.history.Append(channel, &types.HistoryEvent{Event: event, Data: data, Except: except})
+	if err != nil {
+		if hch.options.DevMode {
+			utils.Log().Error("%v", err)
+		}
+		seq = 0
+	}
+	if relay {
+		return hch.broadcaster.emitLocked(channel, event, data, except, seq)
+	}
+	return hch.broadcaster.emit(channel, event, data, except, seq)
+}
+
+// Subscribe a client to a channel, replaying the events after the given sequence before
+// any live event. A history:gap event tells the client that some of them are gone.
+func (hch *HistoryChannel) Join(client Client, channel string, since *int64) {
+	if since == nil || !hch.IsHistory(channel) {
+		client.Join(channel)
+		return
+	}
+
+	if *since < 0 {
+		since = new(int64)
+	}
+
+	lock := hch.broadcaster.lock(channel)
+	lock.Lock()
+	defer lock.Unlock()
+
+	client.Join(channel)
+
+	events, last, err := hch.history.Since(channel, *since)
+	if err != nil {
+		if hch.options.DevMode {
+			utils.Log().Error("%v", err)
+		}
+		return
+	}
+	// The history restarted or dropped the events following the sequence.
+	if *since > last || (last > *since && (len(events) == 0 || events[0].Seq > *since+1)) {
+		client.Emit("history:gap", channel, &types.HistoryGap{Since: *since, Seq: last})
+	}
+	for _, event := range events {
+		if event.Except == client.Id() {
+			continue
+		}
+		client.EmitSequenced(event.Event, channel, event.Data, event.Seq)
+	}
+}
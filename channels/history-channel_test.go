@@ -0,0 +1,141 @@
+package channels
+
+import (
+	"testing"
+
+	"github.com/larisgo/laravel-echo-server/options"
+	"github.com/larisgo/laravel-echo-server/types"
+)
+
+func newTestHistoryChannel(t *testing.T, size int) *HistoryChannel {
+	t.Helper()
+	_options := &options.Config{}
+	_options.History = options.History{Enabled: true, Driver: "memory", Channels: []string{"orders*"}, Size: size}
+	hch, err := NewHistoryChannel(&Broadcaster{}, _options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { hch.Close() })
+	return hch
+}
+
+func appendEvents(t *testing.T, hch *HistoryChannel, channel string, count int, except string) {
+	t.Helper()
+	for i := 0; i < count; i++ {
+		if _, err := hch.history.Append(channel, &types.HistoryEvent{Event: "OrderShipped", Data: i, Except: except}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestHistoryJoinReplays(t *testing.T) {
+	hch := newTestHistoryChannel(t, 10)
+	appendEvents(t, hch, "orders", 5, "")
+
+	client := newTestClient("a")
+	since := int64(2)
+	hch.Join(client, "orders", &since)
+
+	if !client.Has("orders") {
+		t.Fatal("the client did not join the channel")
+	}
+	if len(client.events) != 3 {
+		t.Fatalf("expected 3 replayed events, got %v", client.events)
+	}
+	for i, event := range client.events {
+		if event.event != "OrderShipped" || event.channel != "orders" || event.seq != int64(i+3) {
+			t.Errorf("unexpected event %v", event)
+		}
+	}
+}
+
+func TestHistoryJoinUpToDate(t *testing.T) {
+	hch := newTestHistoryChannel(t, 10)
+	appendEvents(t, hch, "orders", 3, "")
+
+	client := newTestClient("a")
+	since := int64(3)
+	hch.Join(client, "orders", &since)
+	if len(client.events) != 0 {
+		t.Fatalf("an up to date client got %v", client.events)
+	}
+}
+
+func TestHistoryJoinGap(t *testing.T) {
+	hch := newTestHistoryChannel(t, 3)
+	appendEvents(t, hch, "orders", 6, "")
+
+	client := newTestClient("a")
+	since := int64(1)
+	hch.Join(client, "orders", &since)
+
+	if len(client.events) != 4 || client.events[0].event != "history:gap" {
+		t.Fatalf("expected a gap and 3 events, got %v", client.events)
+	}
+	gap := client.events[0].data.(*types.HistoryGap)
+	if gap.Since != 1 || gap.Seq != 6 {
+		t.Errorf("unexpected gap %+v", gap)
+	}
+	if client.events[1].seq != 4 || client.events[3].seq != 6 {
+		t.Errorf("unexpected events %v", client.events[1:])
+	}
+}
+
+func TestHistoryJoinRestarted(t *testing.T) {
+	hch := newTestHistoryChannel(t, 10)
+	appendEvents(t, hch, "orders", 2, "")
+
+	// The client saw more events than the history has, it was forgotten meanwhile.
+	client := newTestClient("a")
+	since := int64(7)
+	hch.Join(client, "orders", &since)
+	if len(client.events) != 1 || client.events[0].event != "history:gap" {
+		t.Fatalf("expected a gap, got %v", client.events)
+	}
+	if gap := client.events[0].data.(*types.HistoryGap); gap.Since != 7 || gap.Seq != 2 {
+		t.Errorf("unexpected gap %+v", gap)
+	}
+}
+
+func TestHistoryJoinSkipsOwnEvents(t *testing.T) {
+	hch := newTestHistoryChannel(t, 10)
+	appendEvents(t, hch, "orders", 2, "a")
+	appendEvents(t, hch, "orders", 1, "")
+
+	client := newTestClient("a")
+	since := int64(0)
+	hch.Join(client, "orders", &since)
+	if len(client.events) != 1 || client.events[0].seq != 3 {
+		t.Fatalf("expected the event of another socket only, got %v", client.events)
+	}
+}
+
+func TestHistoryJoinWithoutSince(t *testing.T) {
+	hch := newTestHistoryChannel(t, 10)
+	appendEvents(t, hch, "orders", 2, "")
+	appendEvents(t, hch, "other", 2, "")
+
+	client := newTestClient("a")
+	hch.Join(client, "orders", nil)
+	since := int64(0)
+	hch.Join(client, "other", &since)
+
+	if !client.Has("orders") || !client.Has("other") {
+		t.Fatal("the client did not join the channels")
+	}
+	if len(client.events) != 0 {
+		t.Fatalf("expected no replay, got %v", client.events)
+	}
+}
+
+func TestHistoryJoinNegativeSince(t *testing.T) {
+	hch := newTestHistoryChannel(t, 10)
+	appendEvents(t, hch, "orders", 2, "")
+
+	client := newTestClient("a")
+	since := int64(-3)
+	hch.Join(client, "orders", &since)
+	if len(client.events) != 2 {
+		t.Fatalf("expected the whole history, got %v", client.events)
+	}
+}
@@ -0,0 +1,263 @@
+package channels
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/larisgo/laravel-echo-server/options"
+	"github.com/larisgo/laravel-echo-server/types"
+	"github.com/zishang520/engine.io/utils"
+)
+
+// A key of a JSON Web Key Set.
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+// A verification key and its optional id.
+type verificationKey struct {
+	kid string
+	key any
+}
+
+type JwtAuthorizer struct {
+
+	// The keys tokens may be signed with.
+	keys []*verificationKey
+
+	// Token parser.
+	parser *jwt.Parser
+
+	// Configurable server options.
+	options *options.Config
+}
+
+// Create a new JWT authorizer instance.
+func NewJwtAuthorizer(_options *options.Config) (*JwtAuthorizer, error) {
+	j := &JwtAuthorizer{}
+	j.options = _options
+	j.keys = []*verificationKey{}
+	for _, secret := range _options.Jwt.Secrets {
+		j.keys = append(j.keys, &verificationKey{key: []byte(secret)})
+	}
+	if _options.Jwt.JwksPath != "" {
+		keys, err := loadJsonWebKeys(_options.Jwt.JwksPath)
+		if err != nil {
+			return nil, err
+		}
+		j.keys = append(j.keys, keys...)
+	}
+	if len(j.keys) == 0 {
+		return nil, errors.New("The JWT authorizer needs secrets or a JWKS file.")
+	}
+
+	parserOptions := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{"HS256", "RS256", "ES256"}),
+		jwt.WithExpirationRequired(),
+		jwt.WithJSONNumber(),
+	}
+	if _options.Jwt.Issuer != "" {
+		parserOptions = append(parserOptions, jwt.WithIssuer(_options.Jwt.Issuer))
+	}
+	if _options.Jwt.Audience != "" {
+		parserOptions = append(parserOptions, jwt.WithAudience(_options.Jwt.Audience))
+	}
+	j.parser = jwt.NewParser(parserOptions...)
+	return j, nil
+}
+
+// Authorize a connection to a channel with the bearer token of its auth headers,
+// reports false if the token is missing, invalid or doesn't cover the channel, or
+// if it has no user id for a presence channel.
+func (j *JwtAuthorizer) Authorize(client Client, data *types.Data, presence bool) (any, bool) {
+	token := j.bearerToken(data.Auth.Headers)
+	if token == "" {
+		return nil, false
+	}
+
+	claims := jwt.MapClaims{}
+	if _, err := j.parser.ParseWithClaims(token, claims, j.keyfunc); err != nil {
+		if j.options.DevMode {
+			utils.Log().Warning(`%s sent an invalid token: %v`, client.Id(), err)
+		}
+		return nil, false
+	}
+	if !j.covers(claims, data.Channel) {
+		return nil, false
+	}
+
+	user, ok := claims[j.options.Jwt.UserIdClaim]
+	if !ok && presence {
+		if j.options.DevMode {
+			utils.Log().Warning(`The token of %s has no user id for the presence channel %s`, client.Id(), data.Channel)
+		}
+		return nil, false
+	}
+
+	if j.options.DevMode {
+		utils.Log().Info(`%s authenticated by token for: %s`, client.Id(), data.Channel)
+	}
+
+	if !ok {
+		return true, true
+	}
+	res_channel_data := &types.AuthenticateData{}
+	encoded, err := json.Marshal(user)
+	if err != nil {
+		return nil, false
+	}
+	if err := json.Unmarshal(encoded, &res_channel_data.ChannelData.UserId); err != nil {
+		return nil, false
+	}
+	if presence && res_channel_data.ChannelData.UserId.String() == "" {
+		return nil, false
+	}
+	res_channel_data.ChannelData.UserInfo = claims[j.options.Jwt.UserInfoClaim]
+	return res_channel_data, true
+}
+
+// Get the bearer token of the Authorization header.
+func (j *JwtAuthorizer) bearerToken(headers map[string]string) string {
+	for key, value := range headers {
+		if strings.EqualFold(key, "Authorization") {
+			if len(value) > 7 && strings.EqualFold(value[:7], "Bearer ") {
+				return strings.TrimSpace(value[7:])
+			}
+		}
+	}
+	return ""
+}
+
+// Check if the channels claim has a pattern matching the channel.
+func (j *JwtAuthorizer) covers(claims jwt.MapClaims, channel string) bool {
+	patterns := []string{}
+	switch claim := claims[j.options.Jwt.ChannelsClaim].(type) {
+	case string:
+		patterns = append(patterns, claim)
+	case []any:
+		for _, pattern := range claim {
+			if pattern, ok := pattern.(string); ok {
+				patterns = append(patterns, pattern)
+			}
+		}
+	}
+	return matchesAny(globs(patterns), channel)
+}
+
+// Get the keys a token may be verified with, those with its key id if any.
+func (j *JwtAuthorizer) keyfunc(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	set := jwt.VerificationKeySet{Keys: []jwt.VerificationKey{}}
+	for _, key := range j.keys {
+		if kid != "" && key.kid != "" && key.kid != kid {
+			continue
+		}
+		switch token.Method.(type) {
+		case *jwt.SigningMethodHMAC:
+			if k, ok := key.key.([]byte); ok {
+				set.Keys = append(set.Keys, k)
+			}
+		case *jwt.SigningMethodRSA:
+			if k, ok := key.key.(*rsa.PublicKey); ok {
+				set.Keys = append(set.Keys, k)
+			}
+		case *jwt.SigningMethodECDSA:
+			if k, ok := key.key.(*ecdsa.PublicKey); ok {
+				set.Keys = append(set.Keys, k)
+			}
+		}
+	}
+	if len(set.Keys) == 0 {
+		return nil, errors.New(fmt.Sprintf("No key to verify a %s token.", token.Method.Alg()))
+	}
+	return set, nil
+}
+
+// Load the keys of a local JWKS file.
+func loadJsonWebKeys(file string) ([]*verificationKey, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var jwks struct {
+		Keys []*jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &jwks); err != nil {
+		return nil, err
+	}
+
+	keys := []*verificationKey{}
+	for _, jwk := range jwks.Keys {
+		key, err := jwk.verificationKey()
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Invalid key %q in %s: %v", jwk.Kid, file, err))
+		}
+		keys = append(keys, &verificationKey{kid: jwk.Kid, key: key})
+	}
+	return keys, nil
+}
+
+// Get the key of a JSON Web Key.
+func (jwk *jsonWebKey) verificationKey() (any, error) {
+	switch jwk.Kty {
+	case "oct":
+		return decodeBase64Url(jwk.K)
+	case "RSA":
+		n, err := decodeBase64Url(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBase64Url(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "EC":
+		if jwk.Crv != "P-256" {
+			return nil, errors.New(fmt.Sprintf("Unsupported curve %s", jwk.Crv))
+		}
+		x, err := decodeBase64Url(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBase64Url(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		key := &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return nil, errors.New("The point is not on the curve")
+		}
+		return key, nil
+	}
+	return nil, errors.New(fmt.Sprintf("Unsupported key type %s", jwk.Kty))
+}
+
+// Decode base64url data, with or without padding.
+func decodeBase64Url(data string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(data, "="))
+}
@@ -0,0 +1,137 @@
+package channels
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/larisgo/laravel-echo-server/options"
+	"github.com/larisgo/laravel-echo-server/types"
+)
+
+const testJwtSecret = "jwt-secret"
+
+// Create an authorizer verifying tokens with a secret and the RSA key of a JWKS file.
+func newTestJwtAuthorizer(t *testing.T, key *rsa.PrivateKey) *JwtAuthorizer {
+	t.Helper()
+	jwks, err := json.Marshal(map[string]any{"keys": []map[string]string{{
+		"kty": "RSA",
+		"kid": "rsa",
+		"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, jwks, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	_options := &options.Config{}
+	_options.Jwt = options.Jwt{
+		Enabled:       true,
+		Secrets:       []string{testJwtSecret},
+		JwksPath:      path,
+		ChannelsClaim: "channels",
+		UserIdClaim:   "sub",
+		UserInfoClaim: "user_info",
+	}
+	j, err := NewJwtAuthorizer(_options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return j
+}
+
+// Sign the claims of a token.
+func signTestToken(t *testing.T, method jwt.SigningMethod, claims jwt.MapClaims, key any) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(method, claims).SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestJwtAuthorize(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	public, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicPem := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: public})
+	j := newTestJwtAuthorizer(t, key)
+
+	claims := func(extra jwt.MapClaims) jwt.MapClaims {
+		claims := jwt.MapClaims{
+			"exp":       time.Now().Add(time.Hour).Unix(),
+			"sub":       "1",
+			"user_info": map[string]any{"name": "Jane"},
+			"channels":  []string{"private-orders.*", "presence-chat"},
+		}
+		for name, value := range extra {
+			if value == nil {
+				delete(claims, name)
+			} else {
+				claims[name] = value
+			}
+		}
+		return claims
+	}
+
+	tests := []struct {
+		name     string
+		token    string
+		channel  string
+		presence bool
+		ok       bool
+	}{
+		{"valid", signTestToken(t, jwt.SigningMethodHS256, claims(nil), []byte(testJwtSecret)), "private-orders.1", false, true},
+		{"valid rsa", signTestToken(t, jwt.SigningMethodRS256, claims(nil), key), "private-orders.1", false, true},
+		{"valid presence", signTestToken(t, jwt.SigningMethodHS256, claims(nil), []byte(testJwtSecret)), "presence-chat", true, true},
+		{"no token", "", "private-orders.1", false, false},
+		{"wrong secret", signTestToken(t, jwt.SigningMethodHS256, claims(nil), []byte("other")), "private-orders.1", false, false},
+		{"expired", signTestToken(t, jwt.SigningMethodHS256, claims(jwt.MapClaims{"exp": time.Now().Add(-time.Minute).Unix()}), []byte(testJwtSecret)), "private-orders.1", false, false},
+		{"no expiry", signTestToken(t, jwt.SigningMethodHS256, claims(jwt.MapClaims{"exp": nil}), []byte(testJwtSecret)), "private-orders.1", false, false},
+		{"alg none", signTestToken(t, jwt.SigningMethodNone, claims(nil), jwt.UnsafeAllowNoneSignatureType), "private-orders.1", false, false},
+		{"hmac with the rsa key", signTestToken(t, jwt.SigningMethodHS256, claims(nil), publicPem), "private-orders.1", false, false},
+		{"hmac with the rsa modulus", signTestToken(t, jwt.SigningMethodHS256, claims(nil), key.N.Bytes()), "private-orders.1", false, false},
+		{"wrong channel", signTestToken(t, jwt.SigningMethodHS256, claims(nil), []byte(testJwtSecret)), "private-invoices.1", false, false},
+		{"single channel", signTestToken(t, jwt.SigningMethodHS256, claims(jwt.MapClaims{"channels": "private-invoices.1"}), []byte(testJwtSecret)), "private-invoices.1", false, true},
+		{"no channels", signTestToken(t, jwt.SigningMethodHS256, claims(jwt.MapClaims{"channels": nil}), []byte(testJwtSecret)), "private-orders.1", false, false},
+		{"private without member", signTestToken(t, jwt.SigningMethodHS256, claims(jwt.MapClaims{"sub": nil}), []byte(testJwtSecret)), "private-orders.1", false, true},
+		{"presence without member", signTestToken(t, jwt.SigningMethodHS256, claims(jwt.MapClaims{"sub": nil}), []byte(testJwtSecret)), "presence-chat", true, false},
+		{"presence with empty member", signTestToken(t, jwt.SigningMethodHS256, claims(jwt.MapClaims{"sub": ""}), []byte(testJwtSecret)), "presence-chat", true, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data := &types.Data{Channel: test.channel, Auth: types.Auth{Headers: map[string]string{}}}
+			if test.token != "" {
+				data.Auth.Headers["authorization"] = "Bearer " + test.token
+			}
+			res, ok := j.Authorize(newTestClient("a"), data, test.presence)
+			if ok != test.ok {
+				t.Fatalf("expected %v, got %v", test.ok, ok)
+			}
+			if ok && test.presence {
+				member, _ := res.(*types.AuthenticateData)
+				if member == nil || member.ChannelData.UserId.String() != "1" || member.ChannelData.UserInfo == nil {
+					t.Fatalf("unexpected member %#v", res)
+				}
+			}
+		})
+	}
+}
@@ -1,13 +1,17 @@
 package channels
 
 import (
-	"encoding/json"
+	"context"
+	"sync"
+	"time"
 
 	"github.com/larisgo/laravel-echo-server/database"
 	"github.com/larisgo/laravel-echo-server/options"
 	"github.com/larisgo/laravel-echo-server/types"
+	_utils "github.com/larisgo/laravel-echo-server/utils"
+	"github.com/larisgo/laravel-echo-server/webhooks"
+	_types "github.com/zishang520/engine.io/types"
 	"github.com/zishang520/engine.io/utils"
-	"github.com/zishang520/socket.io/socket"
 )
 
 type PresenceChannel struct {
@@ -18,39 +22,123 @@ type PresenceChannel struct {
 	// Configurable server options.
 	options *options.Config
 
-	// Socket.io client.
-	io *socket.Server
+	// Emits events to the connections of every transport.
+	broadcaster *Broadcaster
+
+	// Reports the members added and removed to the webhooks.
+	webhooks *webhooks.Webhooks
+
+	// Stops the heartbeat of this node.
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
 }
 
 // Create a NewPresence channel instance.
-func NewPresenceChannel(io *socket.Server, _options *options.Config) (pch *PresenceChannel, err error) {
+func NewPresenceChannel(broadcaster *Broadcaster, _webhooks *webhooks.Webhooks, _options *options.Config) (pch *PresenceChannel, err error) {
 	pch = &PresenceChannel{}
-	pch.io = io
+	pch.broadcaster = broadcaster
+	pch.webhooks = _webhooks
 	pch.options = _options
 	pch.db, err = database.NewDatabase(_options)
 	if err != nil {
 		return nil, err
 	}
+	pch.ctx, pch.cancel = context.WithCancel(context.Background())
+	if _options.Cluster.HeartbeatInterval > 0 {
+		if err := pch.db.Heartbeat(_utils.NodeId, pch.nodeTimeout()); err != nil {
+			pch.db.Close()
+			return nil, err
+		}
+		pch.wg.Add(1)
+		go pch.heartbeat()
+	}
 	return pch, nil
 }
 
 func (pch *PresenceChannel) Close() error {
+	pch.cancel()
+	pch.wg.Wait()
 	return pch.db.Close()
 }
 
-// Get the members of a presence channel.
-func (pch *PresenceChannel) GetMembers(channel string) (members types.Members, _ error) {
-	data, err := pch.db.Get(channel + ":members")
-	if err != nil {
-		return nil, err
+// Refresh the heartbeat of this node and remove the members of the nodes that stopped.
+func (pch *PresenceChannel) heartbeat() {
+	defer pch.wg.Done()
+
+	ticker := time.NewTicker(time.Duration(pch.options.Cluster.HeartbeatInterval) * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-pch.ctx.Done():
+			return
+		case <-ticker.C:
+			if err := pch.db.Heartbeat(_utils.NodeId, pch.nodeTimeout()); err != nil {
+				if pch.options.DevMode {
+					utils.Log().Error("%v", err)
+				}
+			}
+			if err := pch.RemoveExpiredNodes(); err != nil {
+				if pch.options.DevMode {
+					utils.Log().Error("%v", err)
+				}
+			}
+		}
 	}
-	if len(data) == 0 {
-		return members, nil
+}
+
+// The time after which a node without heartbeat is considered gone.
+func (pch *PresenceChannel) nodeTimeout() time.Duration {
+	return time.Duration(pch.options.Cluster.NodeTimeout) * time.Millisecond
+}
+
+// Remove the members of the nodes whose heartbeat has expired and broadcast
+// they have left.
+func (pch *PresenceChannel) RemoveExpiredNodes() error {
+	nodes, err := pch.db.ExpiredNodes()
+	if err != nil {
+		return err
 	}
-	if err := json.Unmarshal(data, &members); err != nil {
-		return nil, err
+	for _, node := range nodes {
+		if node == _utils.NodeId {
+			continue
+		}
+		memberships, err := pch.db.NodeMembers(node)
+		if err != nil {
+			return err
+		}
+		for _, membership := range memberships {
+			member, is_member, err := pch.db.RemoveMember(membership.Channel, membership.SocketId)
+			if err != nil {
+				return err
+			}
+			// Another node removed it first, or another connection of the user remains.
+			if member == nil || is_member {
+				continue
+			}
+			member.SocketId = ""
+			member.NodeId = ""
+			pch.OnLeave(membership.Channel, member)
+		}
+		if pch.webhooks != nil {
+			if err := pch.webhooks.VacateNode(node); err != nil {
+				return err
+			}
+		}
+		if err := pch.db.RemoveNode(node); err != nil {
+			return err
+		}
+		if pch.options.DevMode {
+			utils.Log().Info("Removed the presence members of the stopped node %s", node)
+		}
 	}
-	return members, nil
+	return nil
+}
+
+// Get the members of a presence channel.
+func (pch *PresenceChannel) GetMembers(channel string) (types.Members, error) {
+	return pch.db.GetMembers(channel)
 }
 
 // Check if a user is on a presence channel.
@@ -71,34 +159,54 @@ func (pch *PresenceChannel) IsMember(channel string, member *types.Member) (bool
 	return false, nil
 }
 
-// Remove inactive channel members from the presence channel.
+// Remove inactive channel members from the presence channel. The connections of
+// this node are enough, unless a member was stored without its node.
 func (pch *PresenceChannel) RemoveInactive(channel string, members types.Members, member *types.Member) (_members types.Members, _ error) {
-	clients, err := pch.io.Sockets().In(socket.Room(channel)).AllSockets()
+	local, err := pch.broadcaster.LocalClients(channel)
 	if err != nil {
 		return nil, err
 	}
+	clients := _types.NewSet(local...)
+	for _, member := range members {
+		if member.NodeId == "" {
+			if clients, err = pch.broadcaster.Clients(channel); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
 
 	for _, member := range members {
-		if clients.Has(member.SocketId) {
+		// Members of the other nodes are left to their node, or to the heartbeat once it stopped.
+		if clients.Has(member.SocketId) || (member.NodeId != "" && member.NodeId != _utils.NodeId) {
 			_members = append(_members, member)
+		} else if _, _, err := pch.db.RemoveMember(channel, member.SocketId); err != nil {
+			return nil, err
 		}
 	}
 
-	pch.db.Set(channel+":members", _members)
-
 	return _members, nil
 }
 
 // Join a presence channel and emit that they have joined only if it is the
 // first instance of their presence.
-func (pch *PresenceChannel) Join(socket *socket.Socket, channel string, member *types.Member) error {
+func (pch *PresenceChannel) Join(client Client, channel string, member *types.Member) error {
 	if member == nil {
 		if pch.options.DevMode {
 			utils.Log().Error(`Unable to join channel. Member data for presence channel missing`)
 		}
 		return nil
 	}
-	is_member, err := pch.IsMember(channel, member)
+	// Drop the members of connections that are gone, they are no previous instance.
+	if _, err := pch.IsMember(channel, member); err != nil {
+		if pch.options.DevMode {
+			utils.Log().Error("%v", err)
+		}
+		return err
+	}
+	member.SocketId = client.Id()
+	member.NodeId = _utils.NodeId
+	is_member, err := pch.db.AddMember(channel, member)
 	if err != nil {
 		if pch.options.DevMode {
 			utils.Log().Error("%v", err)
@@ -112,70 +220,83 @@ func (pch *PresenceChannel) Join(socket *socket.Socket, channel string, member *
 		}
 		return err
 	}
-	member.SocketId = socket.Id()
-	members = append(members, member)
 
-	pch.db.Set(channel+":members", members)
-
-	pch.OnSubscribed(socket, channel, members.Unique(true))
+	pch.OnSubscribed(client, channel, members.Unique(true))
 
 	if !is_member {
-		pch.OnJoin(socket, channel, member)
+		pch.OnJoin(client, channel, member)
 	}
 	return nil
 }
 
 // Remove a member from a presenece channel and broadcast they have left
 // only if not other presence channel instances exist.
-func (pch *PresenceChannel) Leave(socket *socket.Socket, channel string) error {
-	members, err := pch.GetMembers(channel)
+func (pch *PresenceChannel) Leave(client Client, channel string) error {
+	member, is_member, err := pch.db.RemoveMember(channel, client.Id())
 	if err != nil {
 		if pch.options.DevMode {
 			utils.Log().Error("%v", err)
 		}
 		return err
 	}
-
-	member := &types.Member{}
-
-	_members := types.Members{}
-	for _, v := range members {
-		if v.SocketId == socket.Id() {
-			member = v
-		} else {
-			_members = append(_members, v)
-		}
+	if member == nil {
+		return nil
 	}
 
-	pch.db.Set(channel+":members", _members)
-
-	is_member, err := pch.IsMember(channel, member)
-	if err != nil {
-		if pch.options.DevMode {
-			// Error retrieving pressence channel members.
-			utils.Log().Error("%v", err)
+	if is_member {
+		// The other instances may belong to connections that are gone.
+		is_member, err = pch.IsMember(channel, member)
+		if err != nil {
+			if pch.options.DevMode {
+				// Error retrieving pressence channel members.
+				utils.Log().Error("%v", err)
+			}
+			return err
 		}
-		return err
 	}
 	if !is_member {
 		member.SocketId = ""
+		member.NodeId = ""
 		pch.OnLeave(channel, member)
 	}
 	return nil
 }
 
+// Hand the membership of a connection over to another connection of the same
+// user, the other members are not told.
+func (pch *PresenceChannel) Transfer(client Client, channel string, from string) error {
+	members, err := pch.GetMembers(channel)
+	if err != nil {
+		return err
+	}
+	for _, member := range members {
+		if member.SocketId != from {
+			continue
+		}
+		member.SocketId = client.Id()
+		member.NodeId = _utils.NodeId
+		if _, err := pch.db.AddMember(channel, member); err != nil {
+			return err
+		}
+		_, _, err := pch.db.RemoveMember(channel, from)
+		return err
+	}
+	return nil
+}
+
 // On join event handler.
-func (pch *PresenceChannel) OnJoin(_socket *socket.Socket, channel string, member *types.Member) {
-	// ch.io.Sockets().Sockets().Load(_socket.Id())
-	_socket.Broadcast().To(socket.Room(channel)).Emit("presence:joining", channel, member)
+func (pch *PresenceChannel) OnJoin(client Client, channel string, member *types.Member) {
+	pch.broadcaster.Emit(channel, "presence:joining", member, client.Id())
+	pch.webhooks.Trigger(&types.WebhookEvent{Name: webhooks.MemberAdded, Channel: channel, UserId: member.UserId.String()})
 }
 
 // On Leave emitter.
 func (pch *PresenceChannel) OnLeave(channel string, member *types.Member) {
-	pch.io.To(socket.Room(channel)).Emit("presence:leaving", channel, member)
+	pch.broadcaster.Emit(channel, "presence:leaving", member, "")
+	pch.webhooks.Trigger(&types.WebhookEvent{Name: webhooks.MemberRemoved, Channel: channel, UserId: member.UserId.String()})
 }
 
 // On subscribed event emitter.
-func (pch *PresenceChannel) OnSubscribed(_socket *socket.Socket, channel string, members types.Members) {
-	pch.io.To(socket.Room(_socket.Id())).Emit("presence:subscribed", channel, members)
+func (pch *PresenceChannel) OnSubscribed(client Client, channel string, members types.Members) {
+	client.Emit("presence:subscribed", channel, members)
 }
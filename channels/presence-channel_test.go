@@ -0,0 +1,107 @@
+package channels
+
+import (
+	"testing"
+	"time"
+
+	"github.com/larisgo/laravel-echo-server/adapters"
+	"github.com/larisgo/laravel-echo-server/options"
+	"github.com/larisgo/laravel-echo-server/types"
+	_utils "github.com/larisgo/laravel-echo-server/utils"
+	"github.com/larisgo/laravel-echo-server/webhooks"
+)
+
+// Create a presence channel storing its members in a temporary SQLite database.
+func newTestPresenceChannel(t *testing.T) (*PresenceChannel, *recordingTransport) {
+	t.Helper()
+	_options := &options.Config{}
+	_options.Database = "sqlite"
+	_options.DatabaseConfig.Sqlite.DatabasePath = t.TempDir() + "/database.sqlite"
+	w, err := webhooks.NewWebhooks(_options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	broadcaster := &Broadcaster{adapter: adapters.NewLocalAdapter()}
+	transport := &recordingTransport{events: map[string]int{}, clients: map[string][]string{}}
+	broadcaster.AddTransport(transport)
+	pch, err := NewPresenceChannel(broadcaster, w, _options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pch.Close() })
+	return pch, transport
+}
+
+// Store a member of a connection on the given node.
+func addTestMember(t *testing.T, pch *PresenceChannel, node string, socket string, user types.UserId) {
+	t.Helper()
+	if _, err := pch.db.AddMember("presence-chat", &types.Member{SocketId: socket, NodeId: node, UserId: user}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Get the user ids of the members of the channel.
+func memberIds(t *testing.T, pch *PresenceChannel) map[string]bool {
+	t.Helper()
+	members, err := pch.GetMembers("presence-chat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := map[string]bool{}
+	for _, member := range members {
+		ids[member.SocketId+":"+member.UserId.String()] = true
+	}
+	return ids
+}
+
+func TestRemoveExpiredNodes(t *testing.T) {
+	pch, transport := newTestPresenceChannel(t)
+	addTestMember(t, pch, "stopped", "a", "1")
+	addTestMember(t, pch, "stopped", "b", "2")
+	addTestMember(t, pch, "running", "c", "2")
+	addTestMember(t, pch, "running", "d", "3")
+	if err := pch.db.Heartbeat("stopped", time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if err := pch.db.Heartbeat("running", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	if err := pch.RemoveExpiredNodes(); err != nil {
+		t.Fatal(err)
+	}
+	ids := memberIds(t, pch)
+	if len(ids) != 2 || !ids["c:2"] || !ids["d:3"] {
+		t.Fatalf("unexpected members %v", ids)
+	}
+	// The user 2 is still connected to the running node.
+	if count := transport.events["presence-chat:presence:leaving"]; count != 1 {
+		t.Fatalf("expected a single leaving member, got %d", count)
+	}
+	nodes, err := pch.db.ExpiredNodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 0 {
+		t.Fatalf("the stopped nodes %v are still kept", nodes)
+	}
+}
+
+func TestJoinKeepsMembersOfOtherNodes(t *testing.T) {
+	pch, transport := newTestPresenceChannel(t)
+	addTestMember(t, pch, _utils.NodeId, "gone", "1")
+	addTestMember(t, pch, "other", "remote", "2")
+	transport.clients["presence-chat"] = []string{"a"}
+
+	if err := pch.Join(newTestClient("a"), "presence-chat", &types.Member{UserId: "3"}); err != nil {
+		t.Fatal(err)
+	}
+	ids := memberIds(t, pch)
+	if len(ids) != 2 || !ids["remote:2"] || !ids["a:3"] {
+		t.Fatalf("unexpected members %v", ids)
+	}
+	if count := transport.events["presence-chat:presence:joining"]; count != 1 {
+		t.Fatalf("expected a joining member, got %d", count)
+	}
+}
@@ -2,18 +2,24 @@ package channels
 
 import (
 	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/larisgo/laravel-echo-server/cache"
 	_http "github.com/larisgo/laravel-echo-server/http"
 	"github.com/larisgo/laravel-echo-server/options"
 	"github.com/larisgo/laravel-echo-server/types"
 	"github.com/zishang520/engine.io/utils"
-	"github.com/zishang520/socket.io/socket"
 )
 
 type PrivateChannel struct {
@@ -21,43 +27,189 @@ type PrivateChannel struct {
 	// Request client.
 	client *_http.Client
 
+	// Authorizes the connections with a token, if enabled.
+	jwt *JwtAuthorizer
+
+	// Caches the auth responses, if enabled.
+	cache cache.CacheDriver
+
 	// Configurable server options.
 	options *options.Config
+
+	// Auth routes of the channel patterns.
+	routes []*authRoute
+}
+
+// The auth route of the channels matching a pattern.
+type authRoute struct {
+	channel *regexp.Regexp
+	route   options.AuthRoute
 }
 
 // Create a new private channel instance.
-func NewPrivateChannel(_options *options.Config) *PrivateChannel {
-	pch := &PrivateChannel{}
+func NewPrivateChannel(_options *options.Config) (pch *PrivateChannel, err error) {
+	pch = &PrivateChannel{}
 	pch.options = _options
-	pch.client = _http.NewClient()
-	return pch
+	pch.client = _http.NewClient(_options)
+	pch.routes = []*authRoute{}
+	for _, route := range _options.AuthRoutes {
+		pch.routes = append(pch.routes, &authRoute{channel: glob(route.Channel), route: route})
+	}
+	if _options.Jwt.Enabled {
+		pch.jwt, err = NewJwtAuthorizer(_options)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if _options.AuthCache.Enabled {
+		pch.cache, err = cache.NewCache(_options)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return pch, nil
 }
 
-// Send authentication request to application server.
-func (pch *PrivateChannel) Authenticate(_socket *socket.Socket, data *types.Data) (any, int, error) {
+func (pch *PrivateChannel) Close() error {
+	if pch.cache != nil {
+		return pch.cache.Close()
+	}
+	return nil
+}
+
+// Forget the cached auth responses of a user.
+func (pch *PrivateChannel) ForgetUser(user string) error {
+	if pch.cache == nil {
+		return errors.New("The auth cache is not enabled.")
+	}
+	return pch.cache.Forget(user)
+}
+
+// Send authentication request to application server, unless the signature or
+// the token sent by the client authorizes the channel. Presence channels need
+// the member data as well.
+func (pch *PrivateChannel) Authenticate(client Client, data *types.Data, presence bool) (any, int, error) {
+	if signing, ok := client.(SigningClient); ok && signing.SignsChannels() {
+		return pch.verifySignature(client, data, presence)
+	}
+	if pch.options.LocalAuth && data.Auth.Signature != "" {
+		return pch.verifySignature(client, data, presence)
+	}
+	if pch.jwt != nil {
+		if res, ok := pch.jwt.Authorize(client, data, presence); ok {
+			return res, http.StatusOK, nil
+		}
+	}
+
 	body, err := json.Marshal(map[string]string{
 		"channel_name": data.Channel,
 	})
 	if err != nil {
 		return nil, http.StatusInternalServerError, err
 	}
+	if data.Auth.Headers == nil {
+		data.Auth.Headers = map[string]string{}
+	}
 	data.Auth.Headers["Content-Type"] = "application/json; charset=UTF-8"
 	options := &_http.Options{
 		Method:  http.MethodPost,
 		Headers: data.Auth.Headers,
-		Url:     pch.authHost(_socket) + pch.options.AuthEndpoint,
 		Body:    bytes.NewReader(body),
 	}
 
+	host, endpoint := "", pch.options.AuthEndpoint
+	if route := pch.route(data.Channel); route != nil {
+		host = route.Host
+		if route.AuthEndpoint != "" {
+			endpoint = route.AuthEndpoint
+		}
+		for key, value := range route.Headers {
+			options.Headers[key] = value
+		}
+		options.Timeout = time.Duration(route.Timeout) * time.Millisecond
+	}
+	if host == "" {
+		host = pch.authHost(client)
+	}
+	options.Url = host + endpoint
+
 	if pch.options.DevMode {
 		utils.Log().Warning(`Sending auth request to: %s`, options.Url)
 	}
 
-	return pch.serverRequest(_socket, options, data.Channel)
+	return pch.serverRequest(client, options, data.Channel)
+}
+
+// Get the auth route of a channel, nil if the defaults apply.
+func (pch *PrivateChannel) route(channel string) *options.AuthRoute {
+	for _, route := range pch.routes {
+		if route.channel.MatchString(channel) {
+			return &route.route
+		}
+	}
+	return nil
+}
+
+// Verify a Pusher style "key:signature" auth string, the signature being the
+// HMAC SHA256 of "socket_id:channel[:channel_data]" with the secret of the client.
+// Presence channels are refused without the channel data of the member.
+func (pch *PrivateChannel) verifySignature(client Client, data *types.Data, presence bool) (any, int, error) {
+	key, signature, ok := strings.Cut(data.Auth.Signature, ":")
+	if !ok {
+		return nil, http.StatusForbidden, errors.New("Invalid auth signature.")
+	}
+	secret := ""
+	if signing, ok := client.(SigningClient); ok && signing.SignsChannels() {
+		// Only the app the connection belongs to signs its subscriptions.
+		if app := signing.App(); app.Key == key {
+			secret = app.Secret
+		}
+	} else {
+		for _, c := range pch.options.Clients {
+			if c.Key == key && c.Secret != "" {
+				secret = c.Secret
+				break
+			}
+		}
+	}
+	if secret == "" {
+		return nil, http.StatusForbidden, errors.New(fmt.Sprintf("No client with key %s can sign channels.", key))
+	}
+
+	payload := client.Id() + ":" + data.Channel
+	if data.ChannelData != "" {
+		payload += ":" + data.ChannelData
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+	if !hmac.Equal([]byte(signature), []byte(hex.EncodeToString(mac.Sum(nil)))) {
+		if pch.options.DevMode {
+			utils.Log().Warning(`%s could not be authenticated to %s`, client.Id(), data.Channel)
+		}
+		return nil, http.StatusForbidden, errors.New("Invalid auth signature.")
+	}
+
+	if pch.options.DevMode {
+		utils.Log().Info(`%s authenticated for: %s`, client.Id(), data.Channel)
+	}
+	if data.ChannelData == "" {
+		if presence {
+			return nil, http.StatusForbidden, errors.New("The presence channel data is missing.")
+		}
+		return true, http.StatusOK, nil
+	}
+	res_channel_data := &types.AuthenticateData{}
+	if err := json.Unmarshal([]byte(data.ChannelData), &res_channel_data.ChannelData); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	if presence && res_channel_data.ChannelData.UserId == "" {
+		return nil, http.StatusForbidden, errors.New("The presence channel data has no user_id.")
+	}
+	return res_channel_data, http.StatusOK, nil
 }
 
 // Get the auth host based on the Socket.
-func (pch *PrivateChannel) authHost(_socket *socket.Socket) string {
+func (pch *PrivateChannel) authHost(client Client) string {
 	_authHosts := pch.options.AuthHost
 	if _authHosts == nil {
 		_authHosts = pch.options.Host
@@ -75,7 +227,7 @@ func (pch *PrivateChannel) authHost(_socket *socket.Socket) string {
 		authHostSelected = authHosts[0]
 	}
 
-	if r := _socket.Request().Headers().Peek("Referer"); r != "" {
+	if r := client.Header("Referer"); r != "" {
 		if referer, err := url.Parse(r); err != nil {
 			for _, authHost := range authHosts {
 				authHostSelected = authHost
@@ -101,45 +253,132 @@ func (pch *PrivateChannel) hasMatchingHost(referer *url.URL, host string) bool {
 }
 
 // Send a request to the server.
-func (pch *PrivateChannel) serverRequest(_socket *socket.Socket, options *_http.Options, channel_name string) (any, int, error) {
-	options.Headers = pch.prepareHeaders(_socket, options)
+func (pch *PrivateChannel) serverRequest(client Client, options *_http.Options, channel_name string) (any, int, error) {
+	options.Headers = pch.prepareHeaders(client, options)
+
+	key := ""
+	if pch.cache != nil {
+		key = pch.cacheKey(options, channel_name)
+	}
+	if key != "" {
+		if body, err := pch.cache.Get(key); err != nil {
+			if pch.options.DevMode {
+				utils.Log().Error("%v", err)
+			}
+		} else if body != nil {
+			if pch.options.DevMode {
+				utils.Log().Info(`%s authenticated from cache for: %s`, client.Id(), channel_name)
+			}
+			return pch.parseResponse(body, http.StatusOK)
+		}
+	}
+
 	response, err := pch.client.Request(options)
 	if err != nil {
 		if pch.options.DevMode {
-			utils.Log().Error(`Error authenticating %s for %s`, _socket.Id(), channel_name)
+			utils.Log().Error(`Error authenticating %s for %s`, client.Id(), channel_name)
 			utils.Log().Error("%v", err)
 		}
+		if errors.Is(err, _http.ErrCircuitOpen) || errors.Is(err, _http.ErrTooManyRequests) {
+			return nil, http.StatusServiceUnavailable, errors.New("The authentication server is unavailable.")
+		}
 		return nil, http.StatusBadGateway, errors.New("Error sending authentication request.")
 	}
 	if response.StatusCode != http.StatusOK {
 		if pch.options.DevMode {
-			utils.Log().Warning(`%s could not be authenticated to %s`, _socket.Id(), channel_name)
+			utils.Log().Warning(`%s could not be authenticated to %s`, client.Id(), channel_name)
 			utils.Log().Error("%s", response.BodyBuffer.String())
 		}
 		return nil, response.StatusCode, errors.New(fmt.Sprintf(`Client can not be authenticated, got HTTP status %d`, response.StatusCode))
 	}
 	if pch.options.DevMode {
-		utils.Log().Info(`%s authenticated for: %s`, _socket.Id(), channel_name)
+		utils.Log().Info(`%s authenticated for: %s`, client.Id(), channel_name)
 	}
 	if response.BodyBuffer == nil {
 		return nil, http.StatusBadGateway, errors.New("Error sending authentication request.")
 	}
+	res, status, err := pch.parseResponse(response.BodyBuffer.Bytes(), response.StatusCode)
+	if err == nil && key != "" {
+		pch.cacheResponse(key, response, res)
+	}
+	return res, status, err
+}
+
+// Parse the body of an auth response.
+func (pch *PrivateChannel) parseResponse(body []byte, status int) (any, int, error) {
 	var res_channel_data *types.AuthenticateData = nil
-	if err := json.Unmarshal(response.BodyBuffer.Bytes(), &res_channel_data); err != nil {
+	if err := json.Unmarshal(body, &res_channel_data); err != nil {
 		var res_bool bool
-		if err := json.Unmarshal(response.BodyBuffer.Bytes(), &res_bool); err != nil {
+		if err := json.Unmarshal(body, &res_bool); err != nil {
 			return nil, http.StatusInternalServerError, err
 		}
-		return res_bool, response.StatusCode, nil
+		return res_bool, status, nil
 	}
 
-	return res_channel_data, response.StatusCode, nil
+	return res_channel_data, status, nil
+}
+
+// The cache key of an auth request, a hash of its url, channel and credentials: the
+// Authorization and Cookie headers. Requests without credentials are not cached.
+func (pch *PrivateChannel) cacheKey(options *_http.Options, channel_name string) string {
+	credentials := map[string]string{}
+	for key, value := range options.Headers {
+		switch key = strings.ToLower(key); key {
+		case "authorization", "cookie":
+			credentials[key] = value
+		}
+	}
+	if credentials["authorization"] == "" && credentials["cookie"] == "" {
+		return ""
+	}
+
+	hash := sha256.New()
+	hash.Write([]byte(options.Url + "\n" + channel_name + "\n"))
+	hash.Write([]byte("authorization:" + credentials["authorization"] + "\ncookie:" + credentials["cookie"] + "\n"))
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// Cache a successful auth response for its Cache-Control max-age, or the default time. Only
+// no-store prevents it, the no-cache and private directives Laravel sends by default do not
+// apply to the server of the connection.
+func (pch *PrivateChannel) cacheResponse(key string, response *_http.Response, res any) {
+	ttl := time.Duration(pch.options.AuthCache.Ttl) * time.Second
+	for _, directive := range strings.Split(response.Header.Get("Cache-Control"), ",") {
+		directive = strings.ToLower(strings.TrimSpace(directive))
+		if directive == "no-store" {
+			return
+		}
+		if strings.HasPrefix(directive, "max-age=") {
+			seconds, err := strconv.ParseInt(strings.TrimPrefix(directive, "max-age="), 10, 64)
+			if err != nil {
+				return
+			}
+			ttl = time.Duration(seconds) * time.Second
+		}
+	}
+	if ttl <= 0 {
+		return
+	}
+
+	// The responses of a known user can be forgotten before they expire.
+	user := ""
+	if pch.options.AuthCache.UserHeader != "" {
+		user = response.Header.Get(pch.options.AuthCache.UserHeader)
+	}
+	if channel_data, ok := res.(*types.AuthenticateData); ok && channel_data != nil && channel_data.ChannelData.UserId != "" {
+		user = channel_data.ChannelData.UserId.String()
+	}
+	if err := pch.cache.Set(key, response.BodyBuffer.Bytes(), user, ttl); err != nil {
+		if pch.options.DevMode {
+			utils.Log().Error("%v", err)
+		}
+	}
 }
 
 // Prepare headers for request to app server.
-func (pch *PrivateChannel) prepareHeaders(_socket *socket.Socket, options *_http.Options) map[string]string {
+func (pch *PrivateChannel) prepareHeaders(client Client, options *_http.Options) map[string]string {
 	if cookie, HasCookie := options.Headers[`Cookie`]; !HasCookie || cookie == "" {
-		if c := _socket.Request().Headers().Peek("Cookie"); c != "" {
+		if c := client.Header("Cookie"); c != "" {
 			options.Headers[`Cookie`] = c
 		}
 	}
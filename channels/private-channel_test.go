@@ -0,0 +1,252 @@
+package channels
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/larisgo/laravel-echo-server/options"
+	"github.com/larisgo/laravel-echo-server/types"
+)
+
+// Sign a subscription the way the Pusher libraries do.
+func signChannel(key string, secret string, socketId string, channel string, channelData string) string {
+	payload := socketId + ":" + channel
+	if channelData != "" {
+		payload += ":" + channelData
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+	return key + ":" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func newTestPrivateChannel(t *testing.T) *PrivateChannel {
+	t.Helper()
+	pch, err := NewPrivateChannel(&options.Config{
+		LocalAuth: true,
+		Clients:   []options.Client{{AppId: "1", Key: "key", Secret: "secret"}, {AppId: "2", Key: "unsigned"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pch
+}
+
+func TestVerifySignature(t *testing.T) {
+	pch := newTestPrivateChannel(t)
+	client := newTestClient("1234.5678")
+
+	data := &types.Data{Channel: "private-orders"}
+	data.Auth.Signature = signChannel("key", "secret", client.Id(), data.Channel, "")
+	if res, status, err := pch.Authenticate(client, data, false); err != nil || status != http.StatusOK || res != true {
+		t.Fatalf("a signed subscription is refused: %v, %d, %v", res, status, err)
+	}
+
+	for name, signature := range map[string]string{
+		"another secret":  signChannel("key", "other", client.Id(), data.Channel, ""),
+		"another socket":  signChannel("key", "secret", "1234.0000", data.Channel, ""),
+		"another channel": signChannel("key", "secret", client.Id(), "private-other", ""),
+		"an unknown key":  signChannel("unknown", "secret", client.Id(), data.Channel, ""),
+		"a key to sign":   signChannel("unsigned", "", client.Id(), data.Channel, ""),
+		"no key":          "0123",
+	} {
+		data := &types.Data{Channel: "private-orders"}
+		data.Auth.Signature = signature
+		if _, status, err := pch.Authenticate(client, data, false); err == nil || status != http.StatusForbidden {
+			t.Errorf("a subscription signed with %s is accepted: %d", name, status)
+		}
+	}
+}
+
+func TestVerifyPresenceSignature(t *testing.T) {
+	pch := newTestPrivateChannel(t)
+	client := newTestClient("1234.5678")
+
+	channelData := `{"user_id":"42","user_info":{"name":"Ada"}}`
+	data := &types.Data{Channel: "presence-chat", ChannelData: channelData}
+	data.Auth.Signature = signChannel("key", "secret", client.Id(), data.Channel, channelData)
+	res, status, err := pch.Authenticate(client, data, true)
+	if err != nil || status != http.StatusOK {
+		t.Fatalf("a signed presence subscription is refused: %d, %v", status, err)
+	}
+	member, ok := res.(*types.AuthenticateData)
+	if !ok || member.ChannelData.UserId.String() != "42" {
+		t.Fatalf("the member is not taken from the channel data: %v", res)
+	}
+
+	// The channel data is signed.
+	data = &types.Data{Channel: "presence-chat", ChannelData: `{"user_id":"1"}`}
+	data.Auth.Signature = signChannel("key", "secret", client.Id(), data.Channel, channelData)
+	if _, status, err := pch.Authenticate(client, data, true); err == nil || status != http.StatusForbidden {
+		t.Errorf("changed channel data is accepted: %d", status)
+	}
+
+	for name, channelData := range map[string]string{"no channel data": "", "no user id": `{"user_info":{}}`} {
+		data := &types.Data{Channel: "presence-chat", ChannelData: channelData}
+		data.Auth.Signature = signChannel("key", "secret", client.Id(), data.Channel, channelData)
+		if _, status, err := pch.Authenticate(client, data, true); err == nil || status != http.StatusForbidden {
+			t.Errorf("a presence subscription with %s is accepted: %d", name, status)
+		}
+	}
+}
+
+func TestSigningClientIsVerified(t *testing.T) {
+	apps := []options.Client{{AppId: "1", Key: "key", Secret: "secret"}, {AppId: "2", Key: "other", Secret: "other-secret"}}
+	pch, err := NewPrivateChannel(&options.Config{Clients: apps})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := newTestClient("1234.5678")
+	client.signs = true
+	client.app = apps[0]
+
+	// Verified even though localAuth is disabled, an unsigned subscription is refused without an auth request.
+	data := &types.Data{Channel: "private-orders"}
+	if _, status, err := pch.Authenticate(client, data, false); err == nil || status != http.StatusForbidden {
+		t.Errorf("an unsigned subscription is accepted: %d", status)
+	}
+	data.Auth.Signature = signChannel("key", "secret", client.Id(), data.Channel, "")
+	if _, status, err := pch.Authenticate(client, data, false); err != nil || status != http.StatusOK {
+		t.Errorf("a signed subscription is refused: %d, %v", status, err)
+	}
+
+	// The subscriptions are signed by the app of the connection only.
+	data = &types.Data{Channel: "private-orders"}
+	data.Auth.Signature = signChannel("other", "other-secret", client.Id(), data.Channel, "")
+	if _, status, err := pch.Authenticate(client, data, false); err == nil || status != http.StatusForbidden {
+		t.Errorf("a subscription signed by another app is accepted: %d", status)
+	}
+}
+
+// Create a private channel caching the responses of an auth server that counts its requests.
+func newTestCachedPrivateChannel(t *testing.T, cacheControl string) (*PrivateChannel, *int32) {
+	t.Helper()
+	requests := new(int32)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+		w.Header().Set("Cache-Control", cacheControl)
+		w.Write([]byte(`true`))
+	}))
+	t.Cleanup(server.Close)
+
+	pch, err := NewPrivateChannel(&options.Config{
+		AuthHost:     server.URL,
+		AuthEndpoint: "/broadcasting/auth",
+		AuthCache:    options.AuthCache{Enabled: true, Driver: "memory", Ttl: 60},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pch.Close() })
+	return pch, requests
+}
+
+// Authenticate a connection with the given credentials.
+func authenticate(t *testing.T, pch *PrivateChannel, socketId string, headers map[string]string) {
+	t.Helper()
+	data := &types.Data{Channel: "private-orders"}
+	data.Auth.Headers = headers
+	if _, status, err := pch.Authenticate(newTestClient(socketId), data, false); err != nil || status != http.StatusOK {
+		t.Fatalf("the subscription is refused: %d, %v", status, err)
+	}
+}
+
+func TestAuthCacheIgnoresNoCache(t *testing.T) {
+	pch, requests := newTestCachedPrivateChannel(t, "no-cache, private")
+
+	// A reconnecting client has another socket id, but the same credentials.
+	authenticate(t, pch, "1.1", map[string]string{"Cookie": "session=a", "X-CSRF-TOKEN": "1"})
+	authenticate(t, pch, "1.2", map[string]string{"cookie": "session=a", "X-CSRF-TOKEN": "2"})
+	if *requests != 1 {
+		t.Fatalf("expected a single auth request, got %d", *requests)
+	}
+
+	authenticate(t, pch, "2.1", map[string]string{"Cookie": "session=b"})
+	authenticate(t, pch, "2.1", map[string]string{"Cookie": "session=a", "Authorization": "Bearer b"})
+	if *requests != 3 {
+		t.Fatalf("the response is shared with other credentials, %d auth requests", *requests)
+	}
+}
+
+func TestAuthCacheNoStore(t *testing.T) {
+	pch, requests := newTestCachedPrivateChannel(t, "no-store")
+	authenticate(t, pch, "1.1", map[string]string{"Cookie": "session=a"})
+	authenticate(t, pch, "1.1", map[string]string{"Cookie": "session=a"})
+	if *requests != 2 {
+		t.Fatalf("a no-store response is cached, %d auth requests", *requests)
+	}
+}
+
+func TestAuthCacheNeedsCredentials(t *testing.T) {
+	pch, requests := newTestCachedPrivateChannel(t, "max-age=60")
+	authenticate(t, pch, "1.1", nil)
+	authenticate(t, pch, "1.2", nil)
+	if *requests != 2 {
+		t.Fatalf("a response without credentials is cached, %d auth requests", *requests)
+	}
+}
+
+// Start an auth endpoint recording the path and the service header of its requests.
+func newTestAuthServer(t *testing.T, delay time.Duration) (*httptest.Server, chan string) {
+	t.Helper()
+	requests := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- r.URL.Path + " " + r.Header.Get("X-Service")
+		time.Sleep(delay)
+		w.Write([]byte(`true`))
+	}))
+	t.Cleanup(server.Close)
+	return server, requests
+}
+
+func TestAuthRoutes(t *testing.T) {
+	fallback, fallbackRequests := newTestAuthServer(t, 0)
+	billing, billingRequests := newTestAuthServer(t, 0)
+	slow, _ := newTestAuthServer(t, 200*time.Millisecond)
+
+	pch, err := NewPrivateChannel(&options.Config{
+		AuthHost:     fallback.URL,
+		AuthEndpoint: "/broadcasting/auth",
+		AuthRoutes: []options.AuthRoute{
+			{Channel: "private-billing.*", Host: billing.URL, AuthEndpoint: "/billing/auth", Headers: map[string]string{"X-Service": "billing"}},
+			{Channel: "private-chat.*", AuthEndpoint: "/chat/auth"},
+			{Channel: "private-slow.*", Host: slow.URL, Timeout: 50},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pch.Close() })
+
+	for _, test := range []struct {
+		channel  string
+		requests chan string
+		request  string
+	}{
+		{"private-billing.1", billingRequests, "/billing/auth billing"},
+		{"private-chat.1", fallbackRequests, "/chat/auth "},
+		{"private-orders.1", fallbackRequests, "/broadcasting/auth "},
+	} {
+		data := &types.Data{Channel: test.channel}
+		if _, status, err := pch.Authenticate(newTestClient("1.1"), data, false); err != nil || status != http.StatusOK {
+			t.Fatalf("%s: the subscription is refused: %d, %v", test.channel, status, err)
+		}
+		select {
+		case request := <-test.requests:
+			if request != test.request {
+				t.Errorf("%s: expected the request %q, got %q", test.channel, test.request, request)
+			}
+		default:
+			t.Errorf("%s: the auth request is sent to another host", test.channel)
+		}
+	}
+
+	if _, status, err := pch.Authenticate(newTestClient("1.1"), &types.Data{Channel: "private-slow.1"}, false); err == nil || status == http.StatusOK {
+		t.Fatalf("the timeout of the route is ignored: %d", status)
+	}
+}
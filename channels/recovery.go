@@ -0,0 +1,347 @@
+package channels
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/larisgo/laravel-echo-server/options"
+	"github.com/zishang520/engine.io/utils"
+)
+
+// An event emitted to a disconnected connection, sent once it recovers.
+type bufferedEvent struct {
+	event   string
+	channel string
+	data    any
+	seq     int64
+}
+
+// The channels of a disconnected connection, kept until it recovers or the grace window expires.
+type session struct {
+
+	// The socket id of the disconnected connection.
+	id string
+
+	// The subscribed channels.
+	channels map[string]struct{}
+
+	// The events emitted since the disconnect.
+	buffer []*bufferedEvent
+
+	// The buffer is full, the connection cannot recover.
+	overflow bool
+
+	// A new connection is taking the channels over, the grace window no longer applies.
+	recovering bool
+
+	// Ends the grace window.
+	timer *time.Timer
+
+	recovery *Recovery
+}
+
+// Keeps the channels and presence memberships of the disconnected Socket.io connections for a
+// grace window. It is a transport, so the connections keep counting as subscribers and their
+// events are buffered.
+type Recovery struct {
+
+	// Leaves the channels once the grace window expires.
+	channel *Channel
+
+	// Disconnected connections by socket id.
+	sessions map[string]*session
+
+	// Signs the recovery tokens.
+	key []byte
+
+	// Configurable server options.
+	options *options.Config
+
+	mu sync.Mutex
+}
+
+// Create a new recovery instance, keeping nothing unless enabled.
+func NewRecovery(channel *Channel, _options *options.Config) (r *Recovery, err error) {
+	r = &Recovery{}
+	r.channel = channel
+	r.sessions = map[string]*session{}
+	r.options = _options
+	r.key = make([]byte, 32)
+	if _, err := rand.Read(r.key); err != nil {
+		return nil, err
+	}
+	if r.Enabled() {
+		channel.Broadcaster.AddTransport(r)
+	}
+	return r, nil
+}
+
+// Leave the channels of all disconnected connections.
+func (r *Recovery) Close() error {
+	r.mu.Lock()
+	sessions := r.sessions
+	r.sessions = map[string]*session{}
+	r.mu.Unlock()
+
+	for _, s := range sessions {
+		s.timer.Stop()
+		r.leave(s, "server shutting down")
+	}
+	return nil
+}
+
+// Check if the disconnected connections are kept.
+func (r *Recovery) Enabled() bool {
+	return r.options.Recovery.Enabled
+}
+
+// Get the token a connection sends to recover, only valid on this server node.
+func (r *Recovery) Token(id string) string {
+	mac := hmac.New(sha256.New, r.key)
+	mac.Write([]byte(id))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Keep the channels of a disconnected connection for the grace window, then leave them.
+// Connections disconnected on purpose leave them right away.
+func (r *Recovery) Hold(client Client, channels []string, reason string) bool {
+	switch reason {
+	case "client namespace disconnect", "server namespace disconnect", "server shutting down":
+		return false
+	}
+	if !r.Enabled() {
+		return false
+	}
+
+	s := &session{id: client.Id(), channels: map[string]struct{}{}, recovery: r}
+	for _, channel := range channels {
+		s.channels[channel] = struct{}{}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.sessions[s.id] = s
+	s.timer = time.AfterFunc(time.Duration(r.options.Recovery.MaxDisconnectionDuration)*time.Millisecond, func() {
+		r.expire(s)
+	})
+
+	if r.options.DevMode {
+		utils.Log().Info(`%s disconnected, keeping its channels (%s)`, s.id, reason)
+	}
+	return true
+}
+
+// Hand the channels of a disconnected connection over to a new connection and send it the
+// events it missed, ahead of any new event. Returns the recovered channels, or false if the
+// token is invalid or the connection is gone.
+func (r *Recovery) Recover(client Client, id string, token string) ([]string, bool) {
+	if !r.Enabled() || !hmac.Equal([]byte(token), []byte(r.Token(id))) {
+		return nil, false
+	}
+
+	// Hold the broadcasts, so that every event is either buffered or sent to the new connection.
+	r.channel.Broadcaster.mu.Lock()
+	r.mu.Lock()
+	s, ok := r.sessions[id]
+	if ok && s.overflow {
+		delete(r.sessions, id)
+	}
+	if ok {
+		s.timer.Stop()
+		s.recovering = true
+	}
+	r.mu.Unlock()
+	if !ok || s.overflow {
+		r.channel.Broadcaster.mu.Unlock()
+		if ok {
+			r.leave(s, "recovery buffer overflow")
+		}
+		return nil, false
+	}
+
+	channels := make([]string, 0, len(s.channels))
+	for channel := range s.channels {
+		client.Join(channel)
+		channels = append(channels, channel)
+	}
+	for _, event := range s.buffer {
+		if event.seq > 0 {
+			client.EmitSequenced(event.event, event.channel, event.data, event.seq)
+		} else {
+			client.Emit(event.event, event.channel, event.data)
+		}
+	}
+
+	// Hand the presence members over while the session still counts as a subscriber and the
+	// broadcasts are held, so the inactive members are never checked without both connections.
+	for _, channel := range channels {
+		if r.channel.IsPresence(channel) {
+			if err := r.channel.Presence.Transfer(client, channel, s.id); err != nil && r.options.DevMode {
+				utils.Log().Error("%v", err)
+			}
+		}
+	}
+
+	r.mu.Lock()
+	delete(r.sessions, id)
+	r.mu.Unlock()
+	r.channel.Broadcaster.mu.Unlock()
+
+	if r.options.DevMode {
+		utils.Log().Info(`%s recovered the channels of %s`, client.Id(), s.id)
+	}
+	return channels, true
+}
+
+// Take the channels of a connection back once Socket.io recovered it, with the same id, its
+// rooms and the packets it missed. Returns false if the grace window expired.
+func (r *Recovery) Resume(client Client) bool {
+	if !r.Enabled() {
+		return false
+	}
+
+	r.mu.Lock()
+	s, ok := r.sessions[client.Id()]
+	if ok {
+		s.timer.Stop()
+		delete(r.sessions, s.id)
+	}
+	r.mu.Unlock()
+	if !ok {
+		return false
+	}
+	// Socket.io sends the missed packets itself, an overflowing buffer is not needed.
+	if r.options.DevMode {
+		utils.Log().Info(`%s recovered its channels`, s.id)
+	}
+	return true
+}
+
+// Leave the channels of a connection that did not recover in time.
+func (r *Recovery) expire(s *session) {
+	r.mu.Lock()
+	if r.sessions[s.id] != s || s.recovering {
+		r.mu.Unlock()
+		return
+	}
+	delete(r.sessions, s.id)
+	r.mu.Unlock()
+
+	r.leave(s, "recovery timeout")
+}
+
+func (r *Recovery) leave(s *session, reason string) {
+	for _, channel := range s.Channels() {
+		r.channel.Leave(s, channel, reason)
+	}
+}
+
+// Buffer an event for the disconnected connections of a channel, one whose buffer is full
+// leaves its channels.
+func (r *Recovery) Emit(channel string, event string, data any, except string, seq int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, s := range r.sessions {
+		if _, ok := s.channels[channel]; !ok || s.id == except || s.overflow {
+			continue
+		}
+		if len(s.buffer) >= r.options.Recovery.BufferSize {
+			s.overflow = true
+			s.buffer = nil
+			s.timer.Reset(0)
+			continue
+		}
+		s.buffer = append(s.buffer, &bufferedEvent{event: event, channel: channel, data: data, seq: seq})
+	}
+	return nil
+}
+
+// Get the disconnected connections subscribed to a channel.
+func (r *Recovery) Clients(channel string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	clients := []string{}
+	for _, s := range r.sessions {
+		if _, ok := s.channels[channel]; ok {
+			clients = append(clients, s.id)
+		}
+	}
+	return clients
+}
+
+// Get the channels of the disconnected connections and their subscription count.
+func (r *Recovery) Channels() map[string]int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	channels := map[string]int{}
+	for _, s := range r.sessions {
+		for channel := range s.channels {
+			channels[channel]++
+		}
+	}
+	return channels
+}
+
+// The disconnected connections are not open.
+func (r *Recovery) Count() int {
+	return 0
+}
+
+func (s *session) Id() string {
+	return s.id
+}
+
+func (s *session) Header(key string) string {
+	return ""
+}
+
+func (s *session) Join(channel string) {
+	s.recovery.mu.Lock()
+	defer s.recovery.mu.Unlock()
+
+	s.channels[channel] = struct{}{}
+}
+
+func (s *session) Leave(channel string) {
+	s.recovery.mu.Lock()
+	defer s.recovery.mu.Unlock()
+
+	delete(s.channels, channel)
+}
+
+func (s *session) Has(channel string) bool {
+	s.recovery.mu.Lock()
+	defer s.recovery.mu.Unlock()
+
+	_, ok := s.channels[channel]
+	return ok
+}
+
+// Get the subscribed channels.
+func (s *session) Channels() []string {
+	s.recovery.mu.Lock()
+	defer s.recovery.mu.Unlock()
+
+	channels := make([]string, 0, len(s.channels))
+	for channel := range s.channels {
+		channels = append(channels, channel)
+	}
+	return channels
+}
+
+// The events of a connection that is gone are dropped.
+func (s *session) Emit(event string, channel string, data any) error {
+	return nil
+}
+
+func (s *session) EmitSequenced(event string, channel string, data any, seq int64) error {
+	return nil
+}
@@ -0,0 +1,138 @@
+package channels
+
+import (
+	"testing"
+	"time"
+
+	"github.com/larisgo/laravel-echo-server/options"
+	"github.com/larisgo/laravel-echo-server/webhooks"
+)
+
+// Create a recovery keeping the disconnected connections for the given window.
+func newTestRecovery(t *testing.T, window int64) *Recovery {
+	t.Helper()
+	_options := &options.Config{}
+	_options.Recovery = options.Recovery{Enabled: true, MaxDisconnectionDuration: window, BufferSize: 10}
+	ch := &Channel{options: _options, Broadcaster: &Broadcaster{}}
+	ch.compileRules(options.Channels{Private: []string{}, Presence: []string{}, ClientEvents: []options.ClientEventRule{}})
+	w, err := webhooks.NewWebhooks(_options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch.Webhooks = w
+	r, err := NewRecovery(ch, _options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { r.Close() })
+	return r
+}
+
+// Disconnect a client subscribed to the given channels.
+func holdTestClient(t *testing.T, r *Recovery, id string, channels ...string) *testClient {
+	t.Helper()
+	client := newTestClient(id)
+	for _, channel := range channels {
+		client.Join(channel)
+	}
+	if !r.Hold(client, channels, "transport close") {
+		t.Fatal("the channels of a disconnected connection are not kept")
+	}
+	return client
+}
+
+// Count the kept connections.
+func sessions(r *Recovery) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.sessions)
+}
+
+func TestRecoveryResume(t *testing.T) {
+	r := newTestRecovery(t, 60000)
+	holdTestClient(t, r, "a", "orders")
+	r.Emit("orders", "OrderShipped", 1, "", 0)
+
+	// Socket.io restored the connection with its id, its rooms and the missed packets.
+	client := newTestClient("a")
+	client.Join("orders")
+	if !r.Resume(client) {
+		t.Fatal("the recovered connection did not take its channels back")
+	}
+	if len(client.events) != 0 {
+		t.Fatalf("the missed events are sent twice, got %v", client.events)
+	}
+	if r.Resume(client) || sessions(r) != 0 {
+		t.Fatal("a connection resumed twice")
+	}
+	if _, ok := r.Recover(newTestClient("b"), "a", r.Token("a")); ok {
+		t.Fatal("a resumed connection is recovered again")
+	}
+}
+
+func TestRecoveryResumeAfterWindow(t *testing.T) {
+	r := newTestRecovery(t, 10)
+	holdTestClient(t, r, "a", "orders")
+	time.Sleep(50 * time.Millisecond)
+
+	if r.Resume(newTestClient("a")) {
+		t.Fatal("a connection resumed after the grace window")
+	}
+	if sessions(r) != 0 {
+		t.Fatal("the expired connection is still kept")
+	}
+}
+
+func TestRecoverReplaysMissedEvents(t *testing.T) {
+	r := newTestRecovery(t, 60000)
+	holdTestClient(t, r, "a", "orders", "news")
+	r.Emit("orders", "OrderShipped", 1, "", 3)
+	r.Emit("news", "Published", 2, "", 0)
+	r.Emit("other", "Ignored", 3, "", 0)
+
+	client := newTestClient("b")
+	channels, ok := r.Recover(client, "a", r.Token("a"))
+	if !ok || len(channels) != 2 {
+		t.Fatalf("unexpected recovery of %v (%v)", channels, ok)
+	}
+	if !client.Has("orders") || !client.Has("news") {
+		t.Fatal("the new connection did not join the channels")
+	}
+	if len(client.events) != 2 || client.events[0].event != "OrderShipped" || client.events[0].seq != 3 || client.events[1].event != "Published" {
+		t.Fatalf("unexpected missed events %v", client.events)
+	}
+}
+
+func TestRecoverRefusesToken(t *testing.T) {
+	r := newTestRecovery(t, 60000)
+	holdTestClient(t, r, "a", "orders")
+
+	if _, ok := r.Recover(newTestClient("b"), "a", r.Token("b")); ok {
+		t.Fatal("a connection recovered with the token of another one")
+	}
+	if _, ok := r.Recover(newTestClient("b"), "a", r.Token("a")); !ok {
+		t.Fatal("a refused token ended the session")
+	}
+}
+
+func TestRecoveryOverflow(t *testing.T) {
+	r := newTestRecovery(t, 60000)
+	holdTestClient(t, r, "a", "orders")
+	for i := 0; i < 11; i++ {
+		r.Emit("orders", "OrderShipped", i, "", 0)
+	}
+
+	if _, ok := r.Recover(newTestClient("b"), "a", r.Token("a")); ok {
+		t.Fatal("a connection whose buffer overflowed is recovered")
+	}
+	if sessions(r) != 0 {
+		t.Fatal("the overflowing connection is still kept")
+	}
+}
+
+func TestHoldOnPurposeDisconnect(t *testing.T) {
+	r := newTestRecovery(t, 60000)
+	if r.Hold(newTestClient("a"), []string{"orders"}, "client namespace disconnect") {
+		t.Fatal("the channels of a connection disconnected on purpose are kept")
+	}
+}
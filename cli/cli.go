@@ -650,13 +650,13 @@ func (c *Cli) getConfigFile(file string, dir string) (string, error) {
 
 // Tries to read a config file
 func (c *Cli) readConfigFile(file string) (*options.Config, error) {
-	var data *options.Config
-
 	bytes_data, err := ioutil.ReadFile(file)
 	if err != nil {
 		return nil, err
 	}
-	if err := json.Unmarshal(bytes_data, &data); err != nil {
+	// Files written by older versions lack the newer options.
+	data, err := options.Decode(c.defaultOptions, bytes_data)
+	if err != nil {
 		return nil, err
 	}
 
@@ -1,5 +1,11 @@
 package database
 
+import (
+	"time"
+
+	"github.com/larisgo/laravel-echo-server/types"
+)
+
 type DatabaseDriver interface {
 
 	// Get a value from the database.
@@ -8,5 +14,50 @@ type DatabaseDriver interface {
 	// Set a value to the database.
 	Set(string, any) error
 
+	// Add a member to a presence channel, reports if another connection of the user is already a member.
+	AddMember(string, *types.Member) (bool, error)
+
+	// Remove a connection from a presence channel, returns its member and reports if another connection of the user is still a member.
+	RemoveMember(string, string) (*types.Member, bool, error)
+
+	// Get the members of a presence channel.
+	GetMembers(string) (types.Members, error)
+
+	// Refresh the heartbeat of a server node, it expires after the given time.
+	Heartbeat(string, time.Duration) error
+
+	// Get the server nodes whose heartbeat has expired.
+	ExpiredNodes() ([]string, error)
+
+	// Get the presence channel memberships owned by a server node.
+	NodeMembers(string) ([]*types.Membership, error)
+
+	// Forget a server node.
+	RemoveNode(string) error
+
+	// Store the last event of a cache channel, it expires after the given time unless zero.
+	SetLastEvent(string, *types.Data, time.Duration) error
+
+	// Get the last event of a cache channel, nil if there is none.
+	GetLastEvent(string) (*types.Data, error)
+
+	// Change the number of subscribers of a channel on a server node by the given delta, returns the new number on every node.
+	Occupy(string, string, int64) (int64, error)
+
+	// Forget the subscribers of a server node, returns the channels left without any.
+	VacateNode(string) ([]string, error)
+
+	// Queue webhook jobs, due right away.
+	PushWebhooks([]*types.WebhookJob) error
+
+	// Claim up to the given number of due webhook jobs, they are due again after the lease unless acknowledged or retried.
+	ClaimWebhooks(int, time.Duration) ([]*types.WebhookJob, error)
+
+	// Store a webhook job again, due at the given time.
+	RetryWebhook(*types.WebhookJob, time.Time) error
+
+	// Delete webhook jobs once done with.
+	AckWebhooks([]int64) error
+
 	Close() error
 }
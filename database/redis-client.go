@@ -0,0 +1,123 @@
+package database
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/larisgo/laravel-echo-server/options"
+)
+
+// The redis client shared by the database, the subscribers, the cluster adapter
+// and the cache, so they use a single connection pool.
+var shared struct {
+	client redis.UniversalClient
+	refs   int
+	mu     sync.Mutex
+}
+
+// Get the shared redis client, connecting on first use. Each call must be
+// paired with a call to ReleaseRedisClient.
+func NewRedisClient(_options *options.Config) (redis.UniversalClient, error) {
+	shared.mu.Lock()
+	defer shared.mu.Unlock()
+
+	if shared.client == nil {
+		client, err := newRedisClient(_options.DatabaseConfig.Redis)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := client.Ping(context.Background()).Result(); err != nil {
+			client.Close()
+			return nil, errors.New(fmt.Sprintf("Redis connection failed: %v", err))
+		}
+		shared.client = client
+	}
+	shared.refs++
+	return shared.client, nil
+}
+
+// Release the shared redis client, closing it once no one uses it.
+func ReleaseRedisClient() error {
+	shared.mu.Lock()
+	defer shared.mu.Unlock()
+
+	if shared.refs == 0 {
+		return nil
+	}
+	shared.refs--
+	if shared.refs > 0 {
+		return nil
+	}
+	client := shared.client
+	shared.client = nil
+	return client.Close()
+}
+
+// Create a client of a single server, of the master of a sentinel group or of a cluster.
+func newRedisClient(config options.Redis) (redis.UniversalClient, error) {
+	tlsConfig, err := redisTlsConfig(config.Tls)
+	if err != nil {
+		return nil, err
+	}
+	if len(config.ClusterAddrs) > 0 {
+		return redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:     config.ClusterAddrs,
+			Username:  config.Username,
+			Password:  config.Password,
+			TLSConfig: tlsConfig,
+		}), nil
+	}
+	if config.SentinelMaster != "" {
+		return redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:       config.SentinelMaster,
+			SentinelAddrs:    config.SentinelAddrs,
+			SentinelPassword: config.SentinelPassword,
+			Username:         config.Username,
+			Password:         config.Password,
+			DB:               config.Db,
+			TLSConfig:        tlsConfig,
+		}), nil
+	}
+	return redis.NewClient(&redis.Options{
+		Addr:      config.Host + ":" + config.Port,
+		Username:  config.Username,
+		Password:  config.Password,
+		DB:        config.Db,
+		TLSConfig: tlsConfig,
+	}), nil
+}
+
+// Get the TLS configuration of the redis connections, nil if disabled.
+func redisTlsConfig(config options.RedisTls) (*tls.Config, error) {
+	if !config.Enabled {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: config.InsecureSkipVerify,
+	}
+	if config.CaPath != "" {
+		ca, err := os.ReadFile(config.CaPath)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, errors.New(fmt.Sprintf("No certificate found in %s", config.CaPath))
+		}
+	}
+	if config.CertPath != "" && config.KeyPath != "" {
+		cert, err := tls.LoadX509KeyPair(config.CertPath, config.KeyPath)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
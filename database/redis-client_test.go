@@ -0,0 +1,180 @@
+package database
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/larisgo/laravel-echo-server/options"
+)
+
+func TestNewRedisClient(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		config options.Redis
+		addr   string
+	}{
+		{"single", options.Redis{Host: "redis", Port: "6380", Db: 2}, "redis:6380"},
+		{"sentinel", options.Redis{Host: "redis", Port: "6379", SentinelMaster: "mymaster", SentinelAddrs: []string{"sentinel:26379"}}, "FailoverClient"},
+		{"cluster", options.Redis{Host: "redis", Port: "6379", ClusterAddrs: []string{"node-1:6379", "node-2:6379"}}, ""},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			client, err := newRedisClient(test.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer client.Close()
+
+			switch c := client.(type) {
+			case *redis.ClusterClient:
+				if test.addr != "" || len(c.Options().Addrs) != 2 {
+					t.Fatalf("unexpected cluster client of %v", c.Options().Addrs)
+				}
+			case *redis.Client:
+				if c.Options().Addr != test.addr || c.Options().DB != test.config.Db {
+					t.Fatalf("unexpected client of %s", c.Options().Addr)
+				}
+			default:
+				t.Fatalf("unexpected client %T", client)
+			}
+		})
+	}
+}
+
+// Write a self-signed certificate and its key.
+func writeTestCertificate(t *testing.T) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "redis"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+		IsCA:         true,
+	}
+	cert, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	certPath, keyPath := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certPath, keyPath
+}
+
+func TestRedisTlsConfig(t *testing.T) {
+	if config, err := redisTlsConfig(options.RedisTls{}); err != nil || config != nil {
+		t.Fatalf("TLS is used while disabled: %v", err)
+	}
+
+	certPath, keyPath := writeTestCertificate(t)
+	config, err := redisTlsConfig(options.RedisTls{Enabled: true, CaPath: certPath, CertPath: certPath, KeyPath: keyPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.RootCAs == nil || len(config.Certificates) != 1 || config.InsecureSkipVerify {
+		t.Fatalf("unexpected TLS configuration %+v", config)
+	}
+
+	if _, err := redisTlsConfig(options.RedisTls{Enabled: true, CaPath: keyPath}); err == nil {
+		t.Fatal("a CA file without certificate is accepted")
+	}
+	if _, err := redisTlsConfig(options.RedisTls{Enabled: true, CaPath: filepath.Join(t.TempDir(), "missing.pem")}); err == nil {
+		t.Fatal("a missing CA file is accepted")
+	}
+}
+
+// Start a Redis server answering every command with PONG.
+func newPongServer(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				reader := bufio.NewReader(conn)
+				for {
+					line, err := reader.ReadString('\n')
+					if err != nil {
+						return
+					}
+					// Answer once the last argument of the command is read.
+					if strings.HasPrefix(line, "*") {
+						count, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+						for i := 0; i < 2*count; i++ {
+							if _, err := reader.ReadString('\n'); err != nil {
+								return
+							}
+						}
+						conn.Write([]byte("+PONG\r\n"))
+					}
+				}
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func TestSharedRedisClient(t *testing.T) {
+	host, port, err := net.SplitHostPort(newPongServer(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_options := &options.Config{}
+	_options.DatabaseConfig.Redis.Host, _options.DatabaseConfig.Redis.Port = host, port
+
+	a, err := NewRedisClient(_options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewRedisClient(_options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a != b {
+		t.Fatal("the database and the subscriber do not share the client")
+	}
+
+	ReleaseRedisClient()
+	if err := a.Ping(context.Background()).Err(); err != nil {
+		t.Fatalf("the client is closed while still used: %v", err)
+	}
+	ReleaseRedisClient()
+	if err := a.Ping(context.Background()).Err(); err != redis.ErrClosed {
+		t.Fatalf("the client is not closed once released, %v", err)
+	}
+}
@@ -3,18 +3,141 @@ package database
 import (
 	"context"
 	"encoding/json"
-	"errors"
-	"fmt"
 	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/larisgo/laravel-echo-server/options"
+	"github.com/larisgo/laravel-echo-server/types"
 )
 
+// Set of the server nodes that own presence members.
+const nodesKey = "laravel-echo-server#nodes"
+
+// Prefix of the keys of a server node.
+const nodeKeyPrefix = "laravel-echo-server#node:"
+
+// Prefix of the keys of the last events of the cache channels.
+const lastEventKeyPrefix = "laravel-echo-server#last_event:"
+
+// Prefix of the keys of the subscriber counts of the channels, by node.
+const occupancyKeyPrefix = "laravel-echo-server#occupancy:"
+
+// Keys of the webhook queue: the jobs by id, their ids by due time and the last id,
+// hash tagged in one cluster slot for the scripts.
+const (
+	webhookJobsKey = "{laravel-echo-server#webhooks}:jobs"
+	webhookDueKey  = "{laravel-echo-server#webhooks}:due"
+	webhookIdKey   = "{laravel-echo-server#webhooks}:id"
+)
+
+// Drop the members a previous version stored as a single JSON value.
+const dropLegacyMembers = `
+if redis.call('TYPE', KEYS[1]).ok == 'string' then
+	redis.call('DEL', KEYS[1])
+end
+`
+
+// Add a member and report if another connection of the user is already a member.
+var addMemberScript = redis.NewScript(dropLegacyMembers + `
+local exists = 0
+for _, user in ipairs(redis.call('HVALS', KEYS[2])) do
+	if user == ARGV[2] then
+		exists = 1
+		break
+	end
+end
+redis.call('HSET', KEYS[1], ARGV[1], ARGV[3])
+redis.call('HSET', KEYS[2], ARGV[1], ARGV[2])
+return exists
+`)
+
+// Remove a connection, return its member and report if another connection of the user is still a member.
+var removeMemberScript = redis.NewScript(dropLegacyMembers + `
+local member = redis.call('HGET', KEYS[1], ARGV[1])
+local user = redis.call('HGET', KEYS[2], ARGV[1])
+redis.call('HDEL', KEYS[1], ARGV[1])
+redis.call('HDEL', KEYS[2], ARGV[1])
+if not member then
+	return {}
+end
+local exists = 0
+for _, u in ipairs(redis.call('HVALS', KEYS[2])) do
+	if u == user then
+		exists = 1
+		break
+	end
+end
+return {member, exists}
+`)
+
+// Get the members of a presence channel.
+var getMembersScript = redis.NewScript(dropLegacyMembers + `
+return redis.call('HVALS', KEYS[1])
+`)
+
+// Change the number of subscribers of a channel on a node, return the number on the node and in total.
+var occupyScript = redis.NewScript(`
+local count = redis.call('HINCRBY', KEYS[1], ARGV[1], ARGV[2])
+if count <= 0 then
+	redis.call('HDEL', KEYS[1], ARGV[1])
+	count = 0
+end
+local total = 0
+for _, c in ipairs(redis.call('HVALS', KEYS[1])) do
+	total = total + tonumber(c)
+end
+return {count, total}
+`)
+
+// Forget the subscribers of a channel on a node, return the number left if there were some.
+var vacateScript = redis.NewScript(`
+if redis.call('HDEL', KEYS[1], ARGV[1]) == 0 then
+	return -1
+end
+local total = 0
+for _, c in ipairs(redis.call('HVALS', KEYS[1])) do
+	total = total + tonumber(c)
+end
+return total
+`)
+
+// Queue webhook jobs, due at the time given first.
+var pushWebhooksScript = redis.NewScript(`
+for i = 2, #ARGV do
+	local id = redis.call('INCR', KEYS[3])
+	redis.call('HSET', KEYS[1], id, ARGV[i])
+	redis.call('ZADD', KEYS[2], ARGV[1], id)
+end
+return #ARGV - 1
+`)
+
+// Claim the due webhook jobs, they are due again at the end of the lease.
+var claimWebhooksScript = redis.NewScript(`
+local ids = redis.call('ZRANGEBYSCORE', KEYS[2], '-inf', ARGV[1], 'LIMIT', 0, ARGV[3])
+local result = {}
+for _, id in ipairs(ids) do
+	local job = redis.call('HGET', KEYS[1], id)
+	if job then
+		redis.call('ZADD', KEYS[2], ARGV[2], id)
+		table.insert(result, id)
+		table.insert(result, job)
+	else
+		redis.call('ZREM', KEYS[2], id)
+	end
+end
+return result
+`)
+
 type RedisDatabase struct {
 
 	// Redis client.
-	redis *redis.Client
+	redis redis.UniversalClient
+
+	// Store the keys of a channel in one cluster slot.
+	cluster bool
 
 	// Configurable server options.
 	options *options.Config
@@ -27,22 +150,19 @@ type RedisDatabase struct {
 func NewRedisDatabase(_options *options.Config) (DatabaseDriver, error) {
 	db := &RedisDatabase{}
 	db.ctx, db.cancel = context.WithCancel(context.Background())
-	db.redis = redis.NewClient(&redis.Options{
-		Addr:     _options.DatabaseConfig.Redis.Host + ":" + _options.DatabaseConfig.Redis.Port,
-		Username: _options.DatabaseConfig.Redis.Username,
-		Password: _options.DatabaseConfig.Redis.Password,
-		DB:       _options.DatabaseConfig.Redis.Db,
-	})
-
-	if _, err := db.redis.Ping(db.ctx).Result(); err != nil {
-		return nil, errors.New(fmt.Sprintf("Redis connection failed: %v", err))
+	client, err := NewRedisClient(_options)
+	if err != nil {
+		return nil, err
 	}
+	db.redis = client
+	db.cluster = len(_options.DatabaseConfig.Redis.ClusterAddrs) > 0
 	db.options = _options
 	return db, nil
 }
 
 func (db *RedisDatabase) Close() error {
-	return db.redis.Close()
+	db.cancel()
+	return ReleaseRedisClient()
 }
 
 // Retrieve data from redis.
@@ -66,11 +186,300 @@ func (db *RedisDatabase) Set(key string, value any) error {
 	if err := db.redis.Set(db.ctx, key, data, 0).Err(); err != nil {
 		return err
 	}
-	if db.options.DatabaseConfig.PublishPresence == true && regexp.MustCompile(`^presence-.*:members$`).MatchString(key) {
+	if regexp.MustCompile(`^presence-.*:members$`).MatchString(key) {
+		return db.publishPresence(key, value)
+	}
+	return nil
+}
+
+// Add a member to a presence channel.
+func (db *RedisDatabase) AddMember(channel string, member *types.Member) (bool, error) {
+	data, err := json.Marshal(member)
+	if err != nil {
+		return false, err
+	}
+	user, err := json.Marshal(member.UserId)
+	if err != nil {
+		return false, err
+	}
+	// Index the membership by node first, a stale entry is ignored when the node expires.
+	if member.NodeId != "" {
+		if err := db.redis.SAdd(db.ctx, nodeKeyPrefix+member.NodeId+":members", member.SocketId+" "+channel).Err(); err != nil {
+			return false, err
+		}
+	}
+	exists, err := addMemberScript.Run(db.ctx, db.redis, db.memberKeys(channel), member.SocketId, user, data).Int()
+	if err != nil {
+		return false, err
+	}
+	return exists == 1, db.membersUpdated(channel)
+}
+
+// Remove a connection from a presence channel.
+func (db *RedisDatabase) RemoveMember(channel string, socketId string) (*types.Member, bool, error) {
+	result, err := removeMemberScript.Run(db.ctx, db.redis, db.memberKeys(channel), socketId).Slice()
+	if err != nil {
+		return nil, false, err
+	}
+	if len(result) < 2 {
+		return nil, false, nil
+	}
+	data, _ := result[0].(string)
+	var member *types.Member
+	if err := json.Unmarshal([]byte(data), &member); err != nil {
+		return nil, false, err
+	}
+	if member.NodeId != "" {
+		if err := db.redis.SRem(db.ctx, nodeKeyPrefix+member.NodeId+":members", socketId+" "+channel).Err(); err != nil {
+			return nil, false, err
+		}
+	}
+	exists, _ := result[1].(int64)
+	return member, exists == 1, db.membersUpdated(channel)
+}
+
+// Get the members of a presence channel.
+func (db *RedisDatabase) GetMembers(channel string) (members types.Members, _ error) {
+	values, err := getMembersScript.Run(db.ctx, db.redis, db.memberKeys(channel)).StringSlice()
+	if err != nil {
+		if err == redis.Nil {
+			return members, nil
+		}
+		return nil, err
+	}
+	for _, value := range values {
+		var member *types.Member
+		if err := json.Unmarshal([]byte(value), &member); err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+	return members, nil
+}
+
+// Refresh the heartbeat of a server node.
+func (db *RedisDatabase) Heartbeat(node string, ttl time.Duration) error {
+	pipe := db.redis.TxPipeline()
+	pipe.SAdd(db.ctx, nodesKey, node)
+	pipe.Set(db.ctx, nodeKeyPrefix+node+":alive", 1, ttl)
+	_, err := pipe.Exec(db.ctx)
+	return err
+}
+
+// Get the server nodes whose heartbeat has expired.
+func (db *RedisDatabase) ExpiredNodes() ([]string, error) {
+	nodes, err := db.redis.SMembers(db.ctx, nodesKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	pipe := db.redis.Pipeline()
+	alive := make([]*redis.IntCmd, len(nodes))
+	for i, node := range nodes {
+		alive[i] = pipe.Exists(db.ctx, nodeKeyPrefix+node+":alive")
+	}
+	if _, err := pipe.Exec(db.ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+	expired := []string{}
+	for i, node := range nodes {
+		if alive[i].Val() == 0 {
+			expired = append(expired, node)
+		}
+	}
+	return expired, nil
+}
+
+// Get the presence channel memberships owned by a server node.
+func (db *RedisDatabase) NodeMembers(node string) ([]*types.Membership, error) {
+	values, err := db.redis.SMembers(db.ctx, nodeKeyPrefix+node+":members").Result()
+	if err != nil {
+		return nil, err
+	}
+	memberships := []*types.Membership{}
+	for _, value := range values {
+		if socketId, channel, ok := strings.Cut(value, " "); ok {
+			memberships = append(memberships, &types.Membership{Channel: channel, SocketId: socketId})
+		}
+	}
+	return memberships, nil
+}
+
+// Forget a server node.
+func (db *RedisDatabase) RemoveNode(node string) error {
+	pipe := db.redis.TxPipeline()
+	pipe.Del(db.ctx, nodeKeyPrefix+node+":members")
+	pipe.Del(db.ctx, nodeKeyPrefix+node+":channels")
+	pipe.Del(db.ctx, nodeKeyPrefix+node+":alive")
+	pipe.SRem(db.ctx, nodesKey, node)
+	_, err := pipe.Exec(db.ctx)
+	return err
+}
+
+// Store the last event of a cache channel.
+func (db *RedisDatabase) SetLastEvent(channel string, message *types.Data, ttl time.Duration) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	return db.redis.Set(db.ctx, lastEventKeyPrefix+channel, data, ttl).Err()
+}
+
+// Get the last event of a cache channel.
+func (db *RedisDatabase) GetLastEvent(channel string) (message *types.Data, _ error) {
+	data, err := db.Get(lastEventKeyPrefix + channel)
+	if err != nil || data == nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &message); err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+// Change the number of subscribers of a channel on a node.
+func (db *RedisDatabase) Occupy(channel string, node string, delta int64) (int64, error) {
+	// Index the channel by node first, a stale entry is ignored when the node expires.
+	if delta > 0 {
+		if err := db.redis.SAdd(db.ctx, nodeKeyPrefix+node+":channels", channel).Err(); err != nil {
+			return 0, err
+		}
+	}
+	result, err := occupyScript.Run(db.ctx, db.redis, []string{occupancyKeyPrefix + channel}, node, delta).Int64Slice()
+	if err != nil {
+		return 0, err
+	}
+	if len(result) < 2 {
+		return 0, nil
+	}
+	if result[0] == 0 {
+		if err := db.redis.SRem(db.ctx, nodeKeyPrefix+node+":channels", channel).Err(); err != nil {
+			return 0, err
+		}
+	}
+	return result[1], nil
+}
+
+// Forget the subscribers of a server node.
+func (db *RedisDatabase) VacateNode(node string) ([]string, error) {
+	channels, err := db.redis.SMembers(db.ctx, nodeKeyPrefix+node+":channels").Result()
+	if err != nil {
+		return nil, err
+	}
+	vacated := []string{}
+	for _, channel := range channels {
+		total, err := vacateScript.Run(db.ctx, db.redis, []string{occupancyKeyPrefix + channel}, node).Int64()
+		if err != nil {
+			return nil, err
+		}
+		if total == 0 {
+			vacated = append(vacated, channel)
+		}
+	}
+	return vacated, db.redis.Del(db.ctx, nodeKeyPrefix+node+":channels").Err()
+}
+
+// Queue webhook jobs.
+func (db *RedisDatabase) PushWebhooks(jobs []*types.WebhookJob) error {
+	if len(jobs) == 0 {
+		return nil
+	}
+	args := []any{time.Now().UnixMilli()}
+	for _, job := range jobs {
+		data, err := json.Marshal(job)
+		if err != nil {
+			return err
+		}
+		args = append(args, data)
+	}
+	return pushWebhooksScript.Run(db.ctx, db.redis, []string{webhookJobsKey, webhookDueKey, webhookIdKey}, args...).Err()
+}
+
+// Claim the due webhook jobs.
+func (db *RedisDatabase) ClaimWebhooks(limit int, lease time.Duration) ([]*types.WebhookJob, error) {
+	now := time.Now()
+	result, err := claimWebhooksScript.Run(db.ctx, db.redis, []string{webhookJobsKey, webhookDueKey}, now.UnixMilli(), now.Add(lease).UnixMilli(), limit).StringSlice()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, nil
+		}
+		return nil, err
+	}
+	jobs := []*types.WebhookJob{}
+	for i := 0; i+1 < len(result); i += 2 {
+		id, err := strconv.ParseInt(result[i], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		var job *types.WebhookJob
+		if err := json.Unmarshal([]byte(result[i+1]), &job); err != nil || job == nil {
+			// A job that cannot be read is never delivered.
+			db.AckWebhooks([]int64{id})
+			continue
+		}
+		job.Id = id
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// Store a webhook job again, due at the given time.
+func (db *RedisDatabase) RetryWebhook(job *types.WebhookJob, due time.Time) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	pipe := db.redis.TxPipeline()
+	pipe.HSet(db.ctx, webhookJobsKey, job.Id, data)
+	pipe.ZAdd(db.ctx, webhookDueKey, &redis.Z{Score: float64(due.UnixMilli()), Member: job.Id})
+	_, err = pipe.Exec(db.ctx)
+	return err
+}
+
+// Delete webhook jobs.
+func (db *RedisDatabase) AckWebhooks(ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	fields := make([]string, len(ids))
+	members := make([]any, len(ids))
+	for i, id := range ids {
+		fields[i] = strconv.FormatInt(id, 10)
+		members[i] = id
+	}
+	pipe := db.redis.TxPipeline()
+	pipe.HDel(db.ctx, webhookJobsKey, fields...)
+	pipe.ZRem(db.ctx, webhookDueKey, members...)
+	_, err := pipe.Exec(db.ctx)
+	return err
+}
+
+// The keys of the members and of their users, hash tagged in a cluster so a script can use both.
+func (db *RedisDatabase) memberKeys(channel string) []string {
+	if db.cluster {
+		channel = "{" + channel + "}"
+	}
+	return []string{channel + ":members", channel + ":members:users"}
+}
+
+// Publish the members of a presence channel after a change.
+func (db *RedisDatabase) membersUpdated(channel string) error {
+	if !db.options.DatabaseConfig.PublishPresence {
+		return nil
+	}
+	members, err := db.GetMembers(channel)
+	if err != nil {
+		return err
+	}
+	return db.publishPresence(channel+":members", members)
+}
+
+// Publish the members of a presence channel if enabled.
+func (db *RedisDatabase) publishPresence(key string, members any) error {
+	if db.options.DatabaseConfig.PublishPresence == true {
 		result, err := json.Marshal(map[string]map[string]any{
 			"event": map[string]any{
 				"channel": key,
-				"members": value,
+				"members": members,
 			},
 		})
 		if err != nil {
@@ -3,19 +3,37 @@ package database
 import (
 	"database/sql"
 	"encoding/json"
+	"fmt"
 	"os"
 	"path"
 	"path/filepath"
+	"sync"
+	"time"
 
 	"github.com/larisgo/laravel-echo-server/options"
+	"github.com/larisgo/laravel-echo-server/types"
 	"github.com/larisgo/laravel-echo-server/utils"
 	_ "github.com/mattn/go-sqlite3"
 )
 
+// How long a write waits for another process holding the database.
+const sqliteBusyTimeout = 5000
+
+// The SQLite connections by database file, shared by the presence channels, the
+// cache channels and the webhooks so their writes wait for each other.
+var sqliteShared struct {
+	dbs  map[string]*sql.DB
+	refs map[string]int
+	mu   sync.Mutex
+}
+
 type SQLiteDatabase struct {
 
 	// SQLite client.
 	sqlite *sql.DB
+
+	// The database file.
+	path string
 }
 
 // Create a new cache instance.
@@ -31,19 +49,87 @@ func NewSQLiteDatabase(_options *options.Config) (DatabaseDriver, error) {
 			return nil, err
 		}
 	}
-	db.sqlite, err = sql.Open("sqlite3", sqlite_db)
+	db.path = sqlite_db
+	db.sqlite, err = openSQLite(sqlite_db)
 	if err != nil {
 		return nil, err
 	}
-
-	if _, err = db.sqlite.Exec(`CREATE TABLE IF NOT EXISTS key_value (key VARCHAR(255), value TEXT);CREATE UNIQUE INDEX IF NOT EXISTS key_index ON key_value (key);`); err != nil {
+	if err := db.migrate(); err != nil {
+		db.Close()
 		return nil, err
 	}
 	return db, nil
 }
 
+// Get the shared connection of a database file, opening it on first use. Each
+// call must be paired with a call to releaseSQLite.
+func openSQLite(file string) (*sql.DB, error) {
+	sqliteShared.mu.Lock()
+	defer sqliteShared.mu.Unlock()
+
+	if sqliteShared.dbs == nil {
+		sqliteShared.dbs = map[string]*sql.DB{}
+		sqliteShared.refs = map[string]int{}
+	}
+	sqlite, ok := sqliteShared.dbs[file]
+	if !ok {
+		// Other processes, like the CLI, wait for the writes instead of failing.
+		var err error
+		sqlite, err = sql.Open("sqlite3", fmt.Sprintf("file:%s?_busy_timeout=%d&_journal_mode=WAL", file, sqliteBusyTimeout))
+		if err != nil {
+			return nil, err
+		}
+		// SQLite allows a single writer, serialize the transactions.
+		sqlite.SetMaxOpenConns(1)
+		sqliteShared.dbs[file] = sqlite
+	}
+	sqliteShared.refs[file]++
+	return sqlite, nil
+}
+
+// Release the shared connection of a database file, closing it once no one uses it.
+func releaseSQLite(file string) error {
+	sqliteShared.mu.Lock()
+	defer sqliteShared.mu.Unlock()
+
+	if sqliteShared.refs[file] == 0 {
+		return nil
+	}
+	sqliteShared.refs[file]--
+	if sqliteShared.refs[file] > 0 {
+		return nil
+	}
+	sqlite := sqliteShared.dbs[file]
+	delete(sqliteShared.dbs, file)
+	delete(sqliteShared.refs, file)
+	return sqlite.Close()
+}
+
+// Create the tables.
+func (db *SQLiteDatabase) migrate() (err error) {
+	if _, err = db.sqlite.Exec(`CREATE TABLE IF NOT EXISTS key_value (key VARCHAR(255), value TEXT);CREATE UNIQUE INDEX IF NOT EXISTS key_index ON key_value (key);`); err != nil {
+		return err
+	}
+	if _, err = db.sqlite.Exec(`CREATE TABLE IF NOT EXISTS presence_members (channel VARCHAR(255), socket_id VARCHAR(255), user_id VARCHAR(255), node VARCHAR(255), member TEXT, PRIMARY KEY (channel, socket_id));CREATE INDEX IF NOT EXISTS presence_members_user_index ON presence_members (channel, user_id);CREATE INDEX IF NOT EXISTS presence_members_node_index ON presence_members (node);`); err != nil {
+		return err
+	}
+	if _, err = db.sqlite.Exec(`CREATE TABLE IF NOT EXISTS nodes (id VARCHAR(255) PRIMARY KEY, expires_at INTEGER);`); err != nil {
+		return err
+	}
+	if _, err = db.sqlite.Exec(`CREATE TABLE IF NOT EXISTS last_events (channel VARCHAR(255) PRIMARY KEY, event TEXT, expires_at INTEGER);`); err != nil {
+		return err
+	}
+	if _, err = db.sqlite.Exec(`CREATE TABLE IF NOT EXISTS node_occupancy (channel VARCHAR(255), node VARCHAR(255), subscribers INTEGER, PRIMARY KEY (channel, node));CREATE INDEX IF NOT EXISTS node_occupancy_node_index ON node_occupancy (node);`); err != nil {
+		return err
+	}
+	if _, err = db.sqlite.Exec(`CREATE TABLE IF NOT EXISTS webhooks (id INTEGER PRIMARY KEY AUTOINCREMENT, job TEXT, due_at INTEGER);CREATE INDEX IF NOT EXISTS webhooks_due_index ON webhooks (due_at);`); err != nil {
+		return err
+	}
+	return nil
+}
+
 func (db *SQLiteDatabase) Close() error {
-	return db.sqlite.Close()
+	return releaseSQLite(db.path)
 }
 
 // Retrieve data from redis.
@@ -76,3 +162,380 @@ func (db *SQLiteDatabase) Set(key string, value any) error {
 	_, err = db.sqlite.Exec("INSERT OR REPLACE INTO key_value (key, value) VALUES (?, ?)", key, data)
 	return err
 }
+
+// Add a member to a presence channel.
+func (db *SQLiteDatabase) AddMember(channel string, member *types.Member) (exists bool, err error) {
+	data, err := json.Marshal(member)
+	if err != nil {
+		return false, err
+	}
+	user, err := json.Marshal(member.UserId)
+	if err != nil {
+		return false, err
+	}
+
+	tx, err := db.sqlite.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if _, err = tx.Exec("INSERT OR REPLACE INTO presence_members (channel, socket_id, user_id, node, member) VALUES (?, ?, ?, ?, ?)", channel, member.SocketId, string(user), member.NodeId, data); err != nil {
+		return false, err
+	}
+	var count int
+	if err = tx.QueryRow("SELECT COUNT(*) FROM presence_members WHERE channel = ? AND user_id = ? AND socket_id != ?", channel, string(user), member.SocketId).Scan(&count); err != nil {
+		return false, err
+	}
+	if err = tx.Commit(); err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// Remove a connection from a presence channel.
+func (db *SQLiteDatabase) RemoveMember(channel string, socketId string) (member *types.Member, exists bool, err error) {
+	tx, err := db.sqlite.Begin()
+	if err != nil {
+		return nil, false, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var user string
+	var data []byte
+	if err = tx.QueryRow("SELECT user_id, member FROM presence_members WHERE channel = ? AND socket_id = ?", channel, socketId).Scan(&user, &data); err != nil {
+		if err == sql.ErrNoRows {
+			err = tx.Commit()
+		}
+		return nil, false, err
+	}
+	if _, err = tx.Exec("DELETE FROM presence_members WHERE channel = ? AND socket_id = ?", channel, socketId); err != nil {
+		return nil, false, err
+	}
+	var count int
+	if err = tx.QueryRow("SELECT COUNT(*) FROM presence_members WHERE channel = ? AND user_id = ?", channel, user).Scan(&count); err != nil {
+		return nil, false, err
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, false, err
+	}
+	if err = json.Unmarshal(data, &member); err != nil {
+		return nil, false, err
+	}
+	return member, count > 0, nil
+}
+
+// Get the members of a presence channel.
+func (db *SQLiteDatabase) GetMembers(channel string) (members types.Members, _ error) {
+	rows, err := db.sqlite.Query("SELECT member FROM presence_members WHERE channel = ? ORDER BY rowid", channel)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var member *types.Member
+		if err := json.Unmarshal(data, &member); err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+// Refresh the heartbeat of a server node.
+func (db *SQLiteDatabase) Heartbeat(node string, ttl time.Duration) error {
+	_, err := db.sqlite.Exec("INSERT OR REPLACE INTO nodes (id, expires_at) VALUES (?, ?)", node, time.Now().Add(ttl).UnixMilli())
+	return err
+}
+
+// Get the server nodes whose heartbeat has expired.
+func (db *SQLiteDatabase) ExpiredNodes() ([]string, error) {
+	rows, err := db.sqlite.Query("SELECT id FROM nodes WHERE expires_at < ?", time.Now().UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	nodes := []string{}
+	for rows.Next() {
+		var node string
+		if err := rows.Scan(&node); err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return nodes, nil
+}
+
+// Get the presence channel memberships owned by a server node.
+func (db *SQLiteDatabase) NodeMembers(node string) ([]*types.Membership, error) {
+	rows, err := db.sqlite.Query("SELECT channel, socket_id FROM presence_members WHERE node = ?", node)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	memberships := []*types.Membership{}
+	for rows.Next() {
+		membership := &types.Membership{}
+		if err := rows.Scan(&membership.Channel, &membership.SocketId); err != nil {
+			return nil, err
+		}
+		memberships = append(memberships, membership)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return memberships, nil
+}
+
+// Forget a server node.
+func (db *SQLiteDatabase) RemoveNode(node string) error {
+	_, err := db.sqlite.Exec("DELETE FROM nodes WHERE id = ?", node)
+	return err
+}
+
+// Store the last event of a cache channel.
+func (db *SQLiteDatabase) SetLastEvent(channel string, message *types.Data, ttl time.Duration) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	var expires int64
+	if ttl > 0 {
+		expires = time.Now().Add(ttl).UnixMilli()
+	}
+	_, err = db.sqlite.Exec("INSERT OR REPLACE INTO last_events (channel, event, expires_at) VALUES (?, ?, ?)", channel, data, expires)
+	return err
+}
+
+// Get the last event of a cache channel, the expired ones are deleted.
+func (db *SQLiteDatabase) GetLastEvent(channel string) (message *types.Data, _ error) {
+	var data []byte
+	var expires int64
+	if err := db.sqlite.QueryRow("SELECT event, expires_at FROM last_events WHERE channel = ?", channel).Scan(&data, &expires); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if expires > 0 && expires <= time.Now().UnixMilli() {
+		_, err := db.sqlite.Exec("DELETE FROM last_events WHERE channel = ? AND expires_at = ?", channel, expires)
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &message); err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+// Change the number of subscribers of a channel on a node, forgetting the node once it has none.
+func (db *SQLiteDatabase) Occupy(channel string, node string, delta int64) (count int64, err error) {
+	tx, err := db.sqlite.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if _, err = tx.Exec("INSERT INTO node_occupancy (channel, node, subscribers) VALUES (?, ?, ?) ON CONFLICT (channel, node) DO UPDATE SET subscribers = subscribers + excluded.subscribers", channel, node, delta); err != nil {
+		return 0, err
+	}
+	if _, err = tx.Exec("DELETE FROM node_occupancy WHERE channel = ? AND node = ? AND subscribers <= 0", channel, node); err != nil {
+		return 0, err
+	}
+	if err = tx.QueryRow("SELECT COALESCE(SUM(subscribers), 0) FROM node_occupancy WHERE channel = ?", channel).Scan(&count); err != nil {
+		return 0, err
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// Forget the subscribers of a server node.
+func (db *SQLiteDatabase) VacateNode(node string) (vacated []string, err error) {
+	tx, err := db.sqlite.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	rows, err := tx.Query("SELECT channel FROM node_occupancy WHERE node = ?", node)
+	if err != nil {
+		return nil, err
+	}
+	channels := []string{}
+	for rows.Next() {
+		var channel string
+		if err = rows.Scan(&channel); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		channels = append(channels, channel)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if _, err = tx.Exec("DELETE FROM node_occupancy WHERE node = ?", node); err != nil {
+		return nil, err
+	}
+	vacated = []string{}
+	for _, channel := range channels {
+		var count int
+		if err = tx.QueryRow("SELECT COUNT(*) FROM node_occupancy WHERE channel = ?", channel).Scan(&count); err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			vacated = append(vacated, channel)
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return vacated, nil
+}
+
+// Queue webhook jobs.
+func (db *SQLiteDatabase) PushWebhooks(jobs []*types.WebhookJob) (err error) {
+	if len(jobs) == 0 {
+		return nil
+	}
+	tx, err := db.sqlite.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	now := time.Now().UnixMilli()
+	for _, job := range jobs {
+		var data []byte
+		if data, err = json.Marshal(job); err != nil {
+			return err
+		}
+		if _, err = tx.Exec("INSERT INTO webhooks (job, due_at) VALUES (?, ?)", data, now); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Claim the due webhook jobs.
+func (db *SQLiteDatabase) ClaimWebhooks(limit int, lease time.Duration) (jobs []*types.WebhookJob, err error) {
+	tx, err := db.sqlite.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	now := time.Now()
+	rows, err := tx.Query("SELECT id, job FROM webhooks WHERE due_at <= ? ORDER BY due_at, id LIMIT ?", now.UnixMilli(), limit)
+	if err != nil {
+		return nil, err
+	}
+	broken := []int64{}
+	for rows.Next() {
+		var id int64
+		var data []byte
+		if err = rows.Scan(&id, &data); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		var job *types.WebhookJob
+		// A job that cannot be read is never delivered.
+		if json.Unmarshal(data, &job) != nil || job == nil {
+			broken = append(broken, id)
+			continue
+		}
+		job.Id = id
+		jobs = append(jobs, job)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, job := range jobs {
+		if _, err = tx.Exec("UPDATE webhooks SET due_at = ? WHERE id = ?", now.Add(lease).UnixMilli(), job.Id); err != nil {
+			return nil, err
+		}
+	}
+	for _, id := range broken {
+		if _, err = tx.Exec("DELETE FROM webhooks WHERE id = ?", id); err != nil {
+			return nil, err
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// Store a webhook job again, due at the given time.
+func (db *SQLiteDatabase) RetryWebhook(job *types.WebhookJob, due time.Time) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	_, err = db.sqlite.Exec("UPDATE webhooks SET job = ?, due_at = ? WHERE id = ?", data, due.UnixMilli(), job.Id)
+	return err
+}
+
+// Delete webhook jobs.
+func (db *SQLiteDatabase) AckWebhooks(ids []int64) (err error) {
+	if len(ids) == 0 {
+		return nil
+	}
+	tx, err := db.sqlite.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	for _, id := range ids {
+		if _, err = tx.Exec("DELETE FROM webhooks WHERE id = ?", id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,211 @@
+package database
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/larisgo/laravel-echo-server/options"
+	"github.com/larisgo/laravel-echo-server/types"
+)
+
+// Open a SQLite database in a temporary directory.
+func newTestSQLite(t *testing.T) DatabaseDriver {
+	t.Helper()
+	_options := &options.Config{}
+	_options.DatabaseConfig.Sqlite.DatabasePath = t.TempDir() + "/database.sqlite"
+	db, err := NewSQLiteDatabase(_options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestAddMemberConcurrently(t *testing.T) {
+	db := newTestSQLite(t)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	first := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			exists, err := db.AddMember("presence-chat", &types.Member{SocketId: fmt.Sprintf("socket-%d", i), UserId: "1"})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if !exists {
+				mu.Lock()
+				first++
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if first != 1 {
+		t.Fatalf("%d connections joined as the first of the user", first)
+	}
+	members, err := db.GetMembers("presence-chat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != 20 {
+		t.Fatalf("expected 20 members, got %d", len(members))
+	}
+}
+
+func TestRemoveMemberConcurrently(t *testing.T) {
+	db := newTestSQLite(t)
+	for i := 0; i < 20; i++ {
+		if _, err := db.AddMember("presence-chat", &types.Member{SocketId: fmt.Sprintf("socket-%d", i), UserId: "1"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	last := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			member, exists, err := db.RemoveMember("presence-chat", fmt.Sprintf("socket-%d", i))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if member == nil {
+				t.Errorf("socket-%d has no member", i)
+				return
+			}
+			if !exists {
+				mu.Lock()
+				last++
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if last != 1 {
+		t.Fatalf("%d connections left as the last of the user", last)
+	}
+}
+
+func TestRemoveMissingMember(t *testing.T) {
+	db := newTestSQLite(t)
+	member, exists, err := db.RemoveMember("presence-chat", "socket-1")
+	if err != nil || member != nil || exists {
+		t.Fatalf("unexpected member %v, %v, %v", member, exists, err)
+	}
+}
+
+func TestMembersOfDifferentUsers(t *testing.T) {
+	db := newTestSQLite(t)
+	if exists, err := db.AddMember("presence-chat", &types.Member{SocketId: "socket-1", UserId: "1"}); err != nil || exists {
+		t.Fatalf("unexpected %v, %v", exists, err)
+	}
+	// The string "1" is another user than the number 1.
+	if exists, err := db.AddMember("presence-chat", &types.Member{SocketId: "socket-2", UserId: `"1"`}); err != nil || exists {
+		t.Fatalf("unexpected %v, %v", exists, err)
+	}
+	if exists, err := db.AddMember("presence-other", &types.Member{SocketId: "socket-3", UserId: "1"}); err != nil || exists {
+		t.Fatalf("unexpected %v, %v", exists, err)
+	}
+	member, exists, err := db.RemoveMember("presence-chat", "socket-1")
+	if err != nil || exists || member == nil || member.UserId != "1" {
+		t.Fatalf("unexpected member %v, %v, %v", member, exists, err)
+	}
+}
+
+func TestSharedConnection(t *testing.T) {
+	_options := &options.Config{}
+	_options.DatabaseConfig.Sqlite.DatabasePath = t.TempDir() + "/database.sqlite"
+	first, err := NewSQLiteDatabase(_options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := NewSQLiteDatabase(_options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+
+	if err := first.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := second.AddMember("presence-chat", &types.Member{SocketId: "socket-1", UserId: "1"}); err != nil {
+		t.Fatalf("closing a database closes the others: %v", err)
+	}
+}
+
+func TestOccupy(t *testing.T) {
+	db := newTestSQLite(t)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	occupied := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			count, err := db.Occupy("orders", fmt.Sprintf("node-%d", i%2), 1)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if count == 1 {
+				mu.Lock()
+				occupied++
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+	if occupied != 1 {
+		t.Fatalf("the channel was occupied %d times", occupied)
+	}
+
+	for i := 19; i >= 0; i-- {
+		count, err := db.Occupy("orders", fmt.Sprintf("node-%d", i%2), -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != int64(i) {
+			t.Fatalf("expected %d subscribers, got %d", i, count)
+		}
+	}
+	if count, err := db.Occupy("orders", "node-0", -1); err != nil || count != 0 {
+		t.Fatalf("a vacated channel has %d subscribers (%v)", count, err)
+	}
+}
+
+func TestVacateNode(t *testing.T) {
+	db := newTestSQLite(t)
+	for _, occupancy := range []struct {
+		channel string
+		node    string
+	}{{"orders", "node-1"}, {"orders", "node-2"}, {"news", "node-1"}, {"news", "node-1"}, {"chat", "node-2"}} {
+		if _, err := db.Occupy(occupancy.channel, occupancy.node, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	vacated, err := db.VacateNode("node-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vacated) != 1 || vacated[0] != "news" {
+		t.Fatalf("expected news to be vacated, got %v", vacated)
+	}
+	if count, err := db.Occupy("orders", "node-2", 0); err != nil || count != 1 {
+		t.Fatalf("orders has %d subscribers left (%v)", count, err)
+	}
+	if vacated, err := db.VacateNode("node-1"); err != nil || len(vacated) != 0 {
+		t.Fatalf("a node is vacated twice: %v (%v)", vacated, err)
+	}
+}
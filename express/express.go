@@ -83,13 +83,18 @@ func (es *Express) AuthorizeRequests(handle httprouter.Handle) httprouter.Handle
 // Check is an incoming r can access the api.
 func (es *Express) CanAccess(r *http.Request, router httprouter.Params) bool {
 	appId := es.GetAppId(router)
-	key := es.GetAuthKey(r)
+	if appId == "" {
+		return false
+	}
 
-	if appId != "" && key != "" {
-		for _, client := range es.options.Clients {
-			if client.AppId == appId {
-				return client.Key == key
+	for _, client := range es.options.Clients {
+		if client.AppId == appId {
+			// The key of a client with a secret is public, its requests must be signed.
+			if client.Secret != "" {
+				return es.HasValidSignature(r, client)
 			}
+			key := es.GetAuthKey(r)
+			return key != "" && client.Key == key
 		}
 	}
 
@@ -0,0 +1,95 @@
+package express
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/larisgo/laravel-echo-server/options"
+)
+
+// How far the auth_timestamp of a signed request may drift from the server time.
+const signatureTimestampTolerance = 600 * time.Second
+
+// Check if a request carries a valid Pusher signature of the client.
+func (es *Express) HasValidSignature(r *http.Request, client options.Client) bool {
+	query := r.URL.Query()
+
+	signature := query.Get("auth_signature")
+	if signature == "" || query.Get("auth_key") != client.Key || query.Get("auth_version") != "1.0" {
+		return false
+	}
+
+	timestamp, err := strconv.ParseInt(query.Get("auth_timestamp"), 10, 64)
+	if err != nil {
+		return false
+	}
+	if drift := time.Since(time.Unix(timestamp, 0)); drift > signatureTimestampTolerance || drift < -signatureTimestampTolerance {
+		return false
+	}
+
+	body, err := es.readBody(r)
+	if err != nil {
+		return false
+	}
+	if len(body) > 0 || query.Has("body_md5") {
+		sum := md5.Sum(body)
+		if query.Get("body_md5") != hex.EncodeToString(sum[:]) {
+			return false
+		}
+	}
+
+	expected := es.Sign(client.Secret, r.Method, r.URL.Path, query)
+	return hmac.Equal([]byte(signature), []byte(expected))
+}
+
+// Sign a request the way the Pusher HTTP API does.
+func (es *Express) Sign(secret string, method string, path string, query map[string][]string) string {
+	params := map[string]string{}
+	keys := []string{}
+	for key, values := range query {
+		key = strings.ToLower(key)
+		if key == "auth_signature" || len(values) == 0 {
+			continue
+		}
+		if _, ok := params[key]; !ok {
+			keys = append(keys, key)
+		}
+		params[key] = values[0]
+	}
+	sort.Strings(keys)
+
+	sb := new(strings.Builder)
+	for _, key := range keys {
+		if sb.Len() > 0 {
+			sb.WriteString("&")
+		}
+		sb.WriteString(key + "=" + params[key])
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strings.ToUpper(method) + "\n" + path + "\n" + sb.String()))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Read the request body and put it back for the handler.
+func (es *Express) readBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil {
+		return []byte{}, nil
+	}
+	body, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
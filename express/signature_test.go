@@ -0,0 +1,128 @@
+package express
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/larisgo/laravel-echo-server/options"
+)
+
+var signatureClient = options.Client{AppId: "3", Key: "278d425bdf160c739803", Secret: "7ad3773142a6692b25b8"}
+
+// Build a request signed by the client, the way the Pusher libraries do.
+func signedRequest(es *Express, client options.Client, body string, timestamp time.Time) *http.Request {
+	query := url.Values{}
+	query.Set("auth_key", client.Key)
+	query.Set("auth_timestamp", strconv.FormatInt(timestamp.Unix(), 10))
+	query.Set("auth_version", "1.0")
+	if body != "" {
+		sum := md5.Sum([]byte(body))
+		query.Set("body_md5", hex.EncodeToString(sum[:]))
+	}
+	query.Set("auth_signature", es.Sign(client.Secret, http.MethodPost, "/apps/3/events", query))
+	return httptest.NewRequest(http.MethodPost, "/apps/3/events?"+query.Encode(), strings.NewReader(body))
+}
+
+func TestSignMatchesPusher(t *testing.T) {
+	es := NewExpress(&options.Config{})
+	query := url.Values{}
+	query.Set("auth_key", "278d425bdf160c739803")
+	query.Set("auth_timestamp", "1353088179")
+	query.Set("auth_version", "1.0")
+	query.Set("body_md5", "ec365a775a4cd0599faeb73354201b6f")
+
+	signature := es.Sign("7ad3773142a6692b25b8", "POST", "/apps/3/events", query)
+	if signature != "da454824c97ba181a32ccc17a72625ba02771f50b50e1e7430e47a1f3f457e6c" {
+		t.Fatalf("unexpected signature %s", signature)
+	}
+}
+
+func TestHasValidSignature(t *testing.T) {
+	es := NewExpress(&options.Config{})
+	body := `{"name":"foo","channels":["project-3"],"data":"{\"some\":\"data\"}"}`
+
+	if r := signedRequest(es, signatureClient, body, time.Now()); !es.HasValidSignature(r, signatureClient) {
+		t.Fatal("a signed request is refused")
+	}
+
+	r := signedRequest(es, signatureClient, body, time.Now())
+	r.Body = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"name":"bar"}`)).Body
+	if es.HasValidSignature(r, signatureClient) {
+		t.Fatal("a request whose body does not match body_md5 is accepted")
+	}
+
+	r = signedRequest(es, signatureClient, body, time.Now())
+	query := r.URL.Query()
+	query.Set("auth_timestamp", strconv.FormatInt(time.Now().Unix()+1, 10))
+	r.URL.RawQuery = query.Encode()
+	if es.HasValidSignature(r, signatureClient) {
+		t.Fatal("a request whose parameters were changed is accepted")
+	}
+
+	if r := signedRequest(es, signatureClient, body, time.Now().Add(-time.Hour)); es.HasValidSignature(r, signatureClient) {
+		t.Fatal("a stale request is accepted")
+	}
+
+	other := signatureClient
+	other.Secret = "other"
+	if r := signedRequest(es, other, body, time.Now()); es.HasValidSignature(r, signatureClient) {
+		t.Fatal("a request signed with another secret is accepted")
+	}
+}
+
+func TestHasValidSignatureKeepsBody(t *testing.T) {
+	es := NewExpress(&options.Config{})
+	body := `{"name":"foo"}`
+	r := signedRequest(es, signatureClient, body, time.Now())
+	if !es.HasValidSignature(r, signatureClient) {
+		t.Fatal("a signed request is refused")
+	}
+	data, err := io.ReadAll(r.Body)
+	if err != nil || string(data) != body {
+		t.Fatalf("the body is not left for the handler, got %q", data)
+	}
+}
+
+func TestCanAccess(t *testing.T) {
+	params := httprouter.Params{{Key: "appId", Value: "3"}}
+	body := `{"name":"foo"}`
+
+	es := NewExpress(&options.Config{Clients: []options.Client{signatureClient}})
+	if r := httptest.NewRequest(http.MethodPost, "/apps/3/events?auth_key="+signatureClient.Key, nil); es.CanAccess(r, params) {
+		t.Fatal("the key alone is accepted for a client with a secret")
+	}
+	r := httptest.NewRequest(http.MethodPost, "/apps/3/events", nil)
+	r.Header.Set("Authorization", "Bearer "+signatureClient.Key)
+	if es.CanAccess(r, params) {
+		t.Fatal("the key as a bearer token is accepted for a client with a secret")
+	}
+	if r := signedRequest(es, signatureClient, body, time.Now()); !es.CanAccess(r, params) {
+		t.Fatal("a signed request is refused")
+	}
+	r = signedRequest(es, signatureClient, body, time.Now())
+	r.URL.RawQuery = strings.Replace(r.URL.RawQuery, "auth_signature=", "auth_signature=0", 1)
+	if es.CanAccess(r, params) {
+		t.Fatal("a request with a wrong signature is accepted with its key")
+	}
+	if r := signedRequest(es, signatureClient, body, time.Now()); es.CanAccess(r, httprouter.Params{{Key: "appId", Value: "4"}}) {
+		t.Fatal("the request of another app is accepted")
+	}
+
+	keyOnly := options.Client{AppId: "3", Key: "skti68i"}
+	es = NewExpress(&options.Config{Clients: []options.Client{keyOnly}})
+	if r := httptest.NewRequest(http.MethodPost, "/apps/3/events?auth_key=skti68i", nil); !es.CanAccess(r, params) {
+		t.Fatal("the key of a client without a secret is refused")
+	}
+	if r := httptest.NewRequest(http.MethodPost, "/apps/3/events?auth_key=other", nil); es.CanAccess(r, params) {
+		t.Fatal("another key is accepted")
+	}
+}
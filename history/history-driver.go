@@ -0,0 +1,16 @@
+package history
+
+import (
+	"github.com/larisgo/laravel-echo-server/types"
+)
+
+type HistoryDriver interface {
+
+	// Number an event with the next sequence of its channel and keep it, dropping the oldest events.
+	Append(string, *types.HistoryEvent) (int64, error)
+
+	// Get the events of a channel after a sequence and the last sequence of the channel.
+	Since(string, int64) ([]*types.HistoryEvent, int64, error)
+
+	Close() error
+}
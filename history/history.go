@@ -0,0 +1,18 @@
+package history
+
+import (
+	"errors"
+
+	"github.com/larisgo/laravel-echo-server/options"
+)
+
+// Create a new history instance.
+func NewHistory(_options *options.Config) (HistoryDriver, error) {
+	switch _options.History.Driver {
+	case "memory":
+		return NewMemoryHistory(_options), nil
+	case "redis":
+		return NewRedisHistory(_options)
+	}
+	return nil, errors.New("The history driver is not set or the history driver is invalid.")
+}
@@ -0,0 +1,128 @@
+package history
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/larisgo/laravel-echo-server/options"
+	"github.com/larisgo/laravel-echo-server/types"
+)
+
+// How often the expired histories are dropped.
+const purgeInterval = time.Minute
+
+// The history of a channel, the event of a sequence is at the sequence modulo the size.
+type memoryChannel struct {
+	seq     int64
+	events  []*types.HistoryEvent
+	expires time.Time
+}
+
+type MemoryHistory struct {
+
+	// Histories by channel.
+	channels map[string]*memoryChannel
+
+	// Configurable server options.
+	options *options.Config
+
+	mu sync.Mutex
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// Create a new history instance.
+func NewMemoryHistory(_options *options.Config) HistoryDriver {
+	h := &MemoryHistory{}
+	h.channels = map[string]*memoryChannel{}
+	h.options = _options
+	h.ctx, h.cancel = context.WithCancel(context.Background())
+	go h.purge()
+	return h
+}
+
+func (h *MemoryHistory) Close() error {
+	h.cancel()
+	return nil
+}
+
+// Number an event and keep it in memory.
+func (h *MemoryHistory) Append(channel string, event *types.HistoryEvent) (int64, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	c, ok := h.channels[channel]
+	if !ok || c.expired(time.Now()) {
+		c = &memoryChannel{events: make([]*types.HistoryEvent, h.size())}
+		h.channels[channel] = c
+	}
+	c.seq++
+	event.Seq = c.seq
+	c.events[c.seq%int64(len(c.events))] = event
+	if ttl := time.Duration(h.options.History.Ttl) * time.Second; ttl > 0 {
+		c.expires = time.Now().Add(ttl)
+	}
+	return c.seq, nil
+}
+
+// Get the events of a channel after a sequence.
+func (h *MemoryHistory) Since(channel string, seq int64) ([]*types.HistoryEvent, int64, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	events := []*types.HistoryEvent{}
+	c, ok := h.channels[channel]
+	if !ok || c.expired(time.Now()) {
+		return events, 0, nil
+	}
+	size := int64(len(c.events))
+	from := seq + 1
+	if from < c.seq-size+1 {
+		from = c.seq - size + 1
+	}
+	if from < 1 {
+		from = 1
+	}
+	for s := from; s <= c.seq; s++ {
+		if event := c.events[s%size]; event != nil && event.Seq == s {
+			events = append(events, event)
+		}
+	}
+	return events, c.seq, nil
+}
+
+// Check if a history has expired, it never does without a ttl.
+func (c *memoryChannel) expired(now time.Time) bool {
+	return !c.expires.IsZero() && now.After(c.expires)
+}
+
+// The number of events kept by channel.
+func (h *MemoryHistory) size() int {
+	if h.options.History.Size > 0 {
+		return h.options.History.Size
+	}
+	return 1
+}
+
+// Drop the expired histories periodically.
+func (h *MemoryHistory) purge() {
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-h.ctx.Done():
+			return
+		case now := <-ticker.C:
+			h.mu.Lock()
+			for channel, c := range h.channels {
+				if c.expired(now) {
+					delete(h.channels, channel)
+				}
+			}
+			h.mu.Unlock()
+		}
+	}
+}
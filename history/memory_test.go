@@ -0,0 +1,67 @@
+package history
+
+import (
+	"testing"
+	"time"
+
+	"github.com/larisgo/laravel-echo-server/options"
+	"github.com/larisgo/laravel-echo-server/types"
+)
+
+func newTestMemoryHistory(t *testing.T, size int, ttl int64) HistoryDriver {
+	t.Helper()
+	_options := &options.Config{}
+	_options.History.Size = size
+	_options.History.Ttl = ttl
+	h := NewMemoryHistory(_options)
+	t.Cleanup(func() { h.Close() })
+	return h
+}
+
+func TestMemoryHistoryNumbersEvents(t *testing.T) {
+	h := newTestMemoryHistory(t, 10, 0)
+	for i := int64(1); i <= 3; i++ {
+		seq, err := h.Append("orders", &types.HistoryEvent{Event: "OrderShipped", Data: i})
+		if err != nil || seq != i {
+			t.Fatalf("expected sequence %d, got %d (%v)", i, seq, err)
+		}
+	}
+	if seq, _ := h.Append("other", &types.HistoryEvent{}); seq != 1 {
+		t.Fatalf("the channels share their sequence, got %d", seq)
+	}
+
+	events, last, err := h.Since("orders", 1)
+	if err != nil || last != 3 || len(events) != 2 || events[0].Seq != 2 || events[1].Seq != 3 {
+		t.Fatalf("unexpected events %v, last %d (%v)", events, last, err)
+	}
+	if events, last, _ := h.Since("orders", 3); len(events) != 0 || last != 3 {
+		t.Fatalf("unexpected events %v, last %d", events, last)
+	}
+}
+
+func TestMemoryHistoryDropsOldest(t *testing.T) {
+	h := newTestMemoryHistory(t, 3, 0)
+	for i := 0; i < 5; i++ {
+		h.Append("orders", &types.HistoryEvent{})
+	}
+	events, last, _ := h.Since("orders", 0)
+	if last != 5 || len(events) != 3 || events[0].Seq != 3 || events[2].Seq != 5 {
+		t.Fatalf("unexpected events %v, last %d", events, last)
+	}
+	if events, _, _ := h.Since("orders", -5); len(events) != 3 {
+		t.Fatalf("a negative sequence returns %d events", len(events))
+	}
+}
+
+func TestMemoryHistoryExpires(t *testing.T) {
+	h := newTestMemoryHistory(t, 3, 1)
+	h.Append("orders", &types.HistoryEvent{})
+	time.Sleep(1100 * time.Millisecond)
+
+	if events, last, _ := h.Since("orders", 0); len(events) != 0 || last != 0 {
+		t.Fatalf("an expired history returns %v, last %d", events, last)
+	}
+	if seq, _ := h.Append("orders", &types.HistoryEvent{}); seq != 1 {
+		t.Fatalf("an expired history continues at %d", seq)
+	}
+}
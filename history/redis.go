@@ -0,0 +1,118 @@
+package history
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/larisgo/laravel-echo-server/database"
+	"github.com/larisgo/laravel-echo-server/options"
+	"github.com/larisgo/laravel-echo-server/types"
+)
+
+// Prefix of the keys of the histories, hash tagged so a script can use both keys
+// of a channel in a cluster.
+const keyPrefix = "laravel-echo-server#history:"
+
+// Number an event, keep the newest events and refresh their expiry. The events
+// are sorted by sequence, prefixed with it so that equal events stay distinct.
+var appendScript = redis.NewScript(`
+local seq = redis.call('INCR', KEYS[1])
+redis.call('ZADD', KEYS[2], seq, seq .. ' ' .. ARGV[1])
+redis.call('ZREMRANGEBYRANK', KEYS[2], 0, -tonumber(ARGV[2]) - 1)
+if tonumber(ARGV[3]) > 0 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[3])
+	redis.call('PEXPIRE', KEYS[2], ARGV[3])
+end
+return seq
+`)
+
+// Get the last sequence, then the events after a sequence.
+var sinceScript = redis.NewScript(`
+local result = redis.call('ZRANGEBYSCORE', KEYS[2], '(' .. ARGV[1], '+inf')
+table.insert(result, 1, redis.call('GET', KEYS[1]) or '0')
+return result
+`)
+
+type RedisHistory struct {
+
+	// Redis client.
+	redis redis.UniversalClient
+
+	// Configurable server options.
+	options *options.Config
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// Create a new history instance.
+func NewRedisHistory(_options *options.Config) (HistoryDriver, error) {
+	h := &RedisHistory{}
+	h.ctx, h.cancel = context.WithCancel(context.Background())
+	client, err := database.NewRedisClient(_options)
+	if err != nil {
+		return nil, err
+	}
+	h.redis = client
+	h.options = _options
+	return h, nil
+}
+
+func (h *RedisHistory) Close() error {
+	h.cancel()
+	return database.ReleaseRedisClient()
+}
+
+// Number an event and keep it in redis.
+func (h *RedisHistory) Append(channel string, event *types.HistoryEvent) (int64, error) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return 0, err
+	}
+	size := h.options.History.Size
+	if size <= 0 {
+		size = 1
+	}
+	ttl := time.Duration(h.options.History.Ttl) * time.Second
+	seq, err := appendScript.Run(h.ctx, h.redis, h.keys(channel), data, size, ttl.Milliseconds()).Int64()
+	if err != nil {
+		return 0, err
+	}
+	event.Seq = seq
+	return seq, nil
+}
+
+// Get the events of a channel after a sequence.
+func (h *RedisHistory) Since(channel string, seq int64) ([]*types.HistoryEvent, int64, error) {
+	values, err := sinceScript.Run(h.ctx, h.redis, h.keys(channel), seq).StringSlice()
+	if err != nil {
+		return nil, 0, err
+	}
+	last, err := strconv.ParseInt(values[0], 10, 64)
+	if err != nil {
+		return nil, 0, err
+	}
+	events := []*types.HistoryEvent{}
+	for _, value := range values[1:] {
+		prefix, data, _ := strings.Cut(value, " ")
+		var event *types.HistoryEvent
+		if err := json.Unmarshal([]byte(data), &event); err != nil || event == nil {
+			continue
+		}
+		if event.Seq, err = strconv.ParseInt(prefix, 10, 64); err != nil {
+			continue
+		}
+		events = append(events, event)
+	}
+	return events, last, nil
+}
+
+// The keys of the last sequence and of the events of a channel.
+func (h *RedisHistory) keys(channel string) []string {
+	key := "{" + keyPrefix + channel + "}"
+	return []string{key + ":seq", key + ":events"}
+}
@@ -0,0 +1,74 @@
+package http
+
+import (
+	"sync"
+	"time"
+)
+
+// Pauses the requests to a host after consecutive failures, then lets a single
+// request through after the cooldown to probe if the host recovered.
+type breaker struct {
+
+	// Consecutive failures opening the circuit, 0 disables the breaker.
+	threshold int
+
+	// Time the circuit stays open.
+	cooldown time.Duration
+
+	// Consecutive failures.
+	failures int
+
+	// End of the cooldown.
+	openUntil time.Time
+
+	// A probe request is in flight.
+	probing bool
+
+	mu sync.Mutex
+}
+
+func newBreaker(threshold int, cooldown time.Duration) *breaker {
+	b := &breaker{}
+	b.threshold = threshold
+	b.cooldown = cooldown
+	return b
+}
+
+// Check if a request may be sent.
+func (b *breaker) allow() bool {
+	if b.threshold <= 0 {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < b.threshold {
+		return true
+	}
+	if b.probing || time.Now().Before(b.openUntil) {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+// Record the outcome of a request.
+func (b *breaker) record(success bool) {
+	if b.threshold <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if success {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openUntil = time.Now().Add(b.cooldown)
+	}
+}
@@ -0,0 +1,74 @@
+package http
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBreakerOpensAfterThreshold(t *testing.T) {
+	b := newBreaker(3, time.Hour)
+	for i := 0; i < 2; i++ {
+		if !b.allow() {
+			t.Fatalf("the breaker opened after %d failures", i)
+		}
+		b.record(false)
+	}
+	if !b.allow() {
+		t.Fatal("the breaker opened before the threshold")
+	}
+	b.record(false)
+	if b.allow() {
+		t.Fatal("the breaker is closed after the threshold")
+	}
+}
+
+func TestBreakerSuccessResets(t *testing.T) {
+	b := newBreaker(2, time.Hour)
+	b.record(false)
+	b.record(true)
+	b.record(false)
+	if !b.allow() {
+		t.Fatal("the failures before a success are counted")
+	}
+}
+
+func TestBreakerProbes(t *testing.T) {
+	b := newBreaker(1, 10*time.Millisecond)
+	b.record(false)
+	if b.allow() {
+		t.Fatal("a request is let through during the cooldown")
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	if !b.allow() {
+		t.Fatal("no probe is let through after the cooldown")
+	}
+	if b.allow() {
+		t.Fatal("a second request is let through while probing")
+	}
+
+	// A failed probe opens the circuit for another cooldown.
+	b.record(false)
+	if b.allow() {
+		t.Fatal("a request is let through after a failed probe")
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	if !b.allow() {
+		t.Fatal("no probe is let through after the second cooldown")
+	}
+	b.record(true)
+	if !b.allow() || !b.allow() {
+		t.Fatal("the breaker is still open after a successful probe")
+	}
+}
+
+func TestBreakerDisabled(t *testing.T) {
+	b := newBreaker(0, time.Hour)
+	for i := 0; i < 10; i++ {
+		b.record(false)
+	}
+	if !b.allow() {
+		t.Fatal("a disabled breaker opened")
+	}
+}
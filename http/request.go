@@ -4,12 +4,20 @@ import (
 	"bytes"
 	"compress/flate"
 	"compress/gzip"
+	"context"
+	"errors"
 	"io"
+	"math/rand"
+	"net"
 	"net/http"
+	"net/url"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/andybalholm/brotli"
+	"github.com/larisgo/laravel-echo-server/options"
+	"github.com/zishang520/engine.io/utils"
 )
 
 type Response struct {
@@ -25,24 +33,146 @@ type Options struct {
 	Body    io.Reader
 }
 
+// Returned while the circuit of a host is open after repeated failures.
+var ErrCircuitOpen = errors.New("The host is unavailable, requests are paused.")
+
+// Returned when no request slot frees up before the timeout.
+var ErrTooManyRequests = errors.New("Too many concurrent requests.")
+
 type Client struct {
+
+	// Shared client, pooling the connections.
+	client *http.Client
+
+	// Configurable server options.
+	options *options.Config
+
+	// Request slots, nil if unlimited.
+	slots chan struct{}
+
+	// Circuit breakers by host.
+	breakers map[string]*breaker
+
+	mu sync.Mutex
 }
 
-func NewClient() *Client {
-	return &Client{}
+func NewClient(_options *options.Config) *Client {
+	c := &Client{}
+	c.options = _options
+	dialer := &net.Dialer{
+		Timeout:   time.Duration(_options.HttpClient.ConnectTimeout) * time.Millisecond,
+		KeepAlive: 30 * time.Second,
+	}
+	c.client = &http.Client{
+		Transport: &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			DialContext:           dialer.DialContext,
+			ForceAttemptHTTP2:     true,
+			MaxIdleConnsPerHost:   _options.HttpClient.MaxIdleConnsPerHost,
+			MaxConnsPerHost:       _options.HttpClient.MaxConnsPerHost,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: 1 * time.Second,
+		},
+	}
+	if _options.HttpClient.MaxConcurrent > 0 {
+		c.slots = make(chan struct{}, _options.HttpClient.MaxConcurrent)
+	}
+	c.breakers = map[string]*breaker{}
+	return c
 }
 
-func (c *Client) Request(options *Options) (res *Response, _ error) {
+// Send a request, retrying connection errors and 5xx responses with a jittered
+// backoff until the timeout.
+func (c *Client) Request(options *Options) (res *Response, err error) {
 	if options == nil {
 		options = &Options{}
 	}
-	client := &http.Client{}
-	if options.Timeout == 0 {
-		client.Timeout = 30 * time.Second
-	} else {
-		client.Timeout = options.Timeout
+	timeout := options.Timeout
+	if timeout == 0 {
+		timeout = time.Duration(c.options.HttpClient.Timeout) * time.Millisecond
+	}
+	if timeout == 0 {
+		timeout = 30 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if c.slots != nil {
+		select {
+		case c.slots <- struct{}{}:
+			defer func() { <-c.slots }()
+		case <-ctx.Done():
+			return nil, ErrTooManyRequests
+		}
+	}
+
+	target, err := url.Parse(options.Url)
+	if err != nil {
+		return nil, err
+	}
+	var body []byte
+	if options.Body != nil {
+		if body, err = io.ReadAll(options.Body); err != nil {
+			return nil, err
+		}
+	}
+
+	// Every request let through is recorded, or a probe would keep the circuit open.
+	b := c.breaker(target.Host)
+	if !b.allow() {
+		return nil, ErrCircuitOpen
+	}
+
+	for attempt := 0; ; attempt++ {
+		res, err = c.do(ctx, options, body)
+		failed := err != nil || res.StatusCode >= http.StatusInternalServerError
+		if !failed || attempt >= c.options.HttpClient.Retries {
+			b.record(!failed)
+			return res, err
+		}
+		if c.options.DevMode {
+			if err != nil {
+				utils.Log().Warning("Retrying request to %s: %v", options.Url, err)
+			} else {
+				utils.Log().Warning("Retrying request to %s: got HTTP status %d", options.Url, res.StatusCode)
+			}
+		}
+		select {
+		case <-time.After(c.backoff(attempt)):
+		case <-ctx.Done():
+			b.record(false)
+			return res, err
+		}
+	}
+}
+
+// The delay before a retry, doubled on each attempt and jittered.
+func (c *Client) backoff(attempt int) time.Duration {
+	delay := time.Duration(c.options.HttpClient.RetryDelay) * time.Millisecond << attempt
+	return time.Duration(float64(delay) * (0.5 + rand.Float64()))
+}
+
+// Get the circuit breaker of a host.
+func (c *Client) breaker(host string) *breaker {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	b, ok := c.breakers[host]
+	if !ok {
+		b = newBreaker(c.options.HttpClient.BreakerThreshold, time.Duration(c.options.HttpClient.BreakerCooldown)*time.Millisecond)
+		c.breakers[host] = b
+	}
+	return b
+}
+
+// Send a request once.
+func (c *Client) do(ctx context.Context, options *Options, payload []byte) (res *Response, _ error) {
+	var reader io.Reader
+	if payload != nil {
+		reader = bytes.NewReader(payload)
 	}
-	request, err := http.NewRequest(strings.ToUpper(options.Method), options.Url, options.Body)
+	request, err := http.NewRequestWithContext(ctx, strings.ToUpper(options.Method), options.Url, reader)
 	if err != nil {
 		return nil, err
 	}
@@ -51,12 +181,12 @@ func (c *Client) Request(options *Options) (res *Response, _ error) {
 			request.Header.Set(key, value)
 		}
 	}
-	if _, HasContentType := request.Header["Content-Type"]; options.Body != nil && !HasContentType {
+	if _, HasContentType := request.Header["Content-Type"]; payload != nil && !HasContentType {
 		request.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=UTF-8")
 	}
 	request.Header.Set("Accept-Encoding", "gzip, deflate, br")
 
-	response, err := client.Do(request)
+	response, err := c.client.Do(request)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,81 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/larisgo/laravel-echo-server/options"
+)
+
+// A body that cannot be read.
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, errors.New("unreadable")
+}
+
+func newTestClient(threshold int, cooldown int64) *Client {
+	_options := &options.Config{}
+	_options.HttpClient.Timeout = 5000
+	_options.HttpClient.BreakerThreshold = threshold
+	_options.HttpClient.BreakerCooldown = cooldown
+	return NewClient(_options)
+}
+
+func TestRequestOpensCircuit(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	c := newTestClient(2, 60000)
+	for i := 0; i < 2; i++ {
+		if _, err := c.Request(&Options{Method: http.MethodPost, Url: server.URL}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := c.Request(&Options{Method: http.MethodPost, Url: server.URL}); err != ErrCircuitOpen {
+		t.Fatalf("expected the circuit to be open, got %v", err)
+	}
+	if n := atomic.LoadInt32(&requests); n != 2 {
+		t.Fatalf("%d requests reached the host", n)
+	}
+}
+
+func TestUnreadableBodyKeepsProbe(t *testing.T) {
+	var healthy int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&healthy) == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	c := newTestClient(1, 10)
+	if _, err := c.Request(&Options{Method: http.MethodPost, Url: server.URL}); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	atomic.StoreInt32(&healthy, 1)
+
+	// The request fails before being let through, the probe stays available.
+	if _, err := c.Request(&Options{Method: http.MethodPost, Url: server.URL, Body: failingReader{}}); err == nil || err == ErrCircuitOpen {
+		t.Fatalf("expected the body error, got %v", err)
+	}
+	res, err := c.Request(&Options{Method: http.MethodPost, Url: server.URL})
+	if err != nil {
+		t.Fatalf("the probe was lost: %v", err)
+	}
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status %d", res.StatusCode)
+	}
+	if _, err := c.Request(&Options{Method: http.MethodPost, Url: server.URL}); err != nil {
+		t.Fatalf("the circuit is still open after a successful probe: %v", err)
+	}
+}
@@ -5,17 +5,31 @@ import (
 )
 
 type Client struct {
-	AppId string `json:"appId"`
-	Key   string `json:"key"`
+	AppId  string `json:"appId"`
+	Key    string `json:"key"`
+	Secret string `json:"secret,omitempty"`
+}
+
+type RedisTls struct {
+	Enabled            bool   `json:"enabled"`
+	CaPath             string `json:"caPath"`
+	CertPath           string `json:"certPath"`
+	KeyPath            string `json:"keyPath"`
+	InsecureSkipVerify bool   `json:"insecureSkipVerify"`
 }
 
 type Redis struct {
-	Host      string `json:"host"`
-	Port      string `json:"port"`
-	Username  string `json:"username"`
-	Password  string `json:"password"`
-	KeyPrefix string `json:"keyPrefix"`
-	Db        int    `json:"db"`
+	Host             string   `json:"host"`
+	Port             string   `json:"port"`
+	Username         string   `json:"username"`
+	Password         string   `json:"password"`
+	KeyPrefix        string   `json:"keyPrefix"`
+	Db               int      `json:"db"`
+	SentinelMaster   string   `json:"sentinelMaster"`
+	SentinelAddrs    []string `json:"sentinelAddrs"`
+	SentinelPassword string   `json:"sentinelPassword"`
+	ClusterAddrs     []string `json:"clusterAddrs"`
+	Tls              RedisTls `json:"tls"`
 }
 
 type Sqlite struct {
@@ -31,8 +45,153 @@ type DatabaseConfig struct {
 type Hosts []string
 
 type Subscribers struct {
-	Http  bool `json:"http"`
-	Redis bool `json:"redis"`
+	Http        bool `json:"http"`
+	Redis       bool `json:"redis"`
+	RedisStream bool `json:"redisStream"`
+	Postgres    bool `json:"postgres"`
+	Amqp        bool `json:"amqp"`
+	Nats        bool `json:"nats"`
+	Kafka       bool `json:"kafka"`
+}
+
+type RedisStream struct {
+	Stream    string `json:"stream"`
+	Group     string `json:"group"`
+	Consumer  string `json:"consumer"`
+	BatchSize int64  `json:"batchSize"`
+	MaxLen    int64  `json:"maxLen"`
+	ClaimIdle int64  `json:"claimIdle"`
+}
+
+type Postgres struct {
+	Dsn          string   `json:"dsn"`
+	Channels     []string `json:"channels"`
+	PayloadTable string   `json:"payloadTable"`
+}
+
+type Amqp struct {
+	Url             string   `json:"url"`
+	Queue           string   `json:"queue"`
+	Exchange        string   `json:"exchange"`
+	BindingKeys     []string `json:"bindingKeys"`
+	KeyPrefix       string   `json:"keyPrefix"`
+	Prefetch        int      `json:"prefetch"`
+	DeadLetterQueue string   `json:"deadLetterQueue"`
+}
+
+type Nats struct {
+	Url     string `json:"url"`
+	Subject string `json:"subject"`
+	Durable string `json:"durable"`
+}
+
+type Kafka struct {
+	Brokers        []string `json:"brokers"`
+	Topics         []string `json:"topics"`
+	GroupId        string   `json:"groupId"`
+	StartOffset    string   `json:"startOffset"`
+	ChannelHeader  string   `json:"channelHeader"`
+	CommitBatch    int      `json:"commitBatch"`
+	CommitInterval int64    `json:"commitInterval"`
+}
+
+type SubscriberConfig struct {
+	RedisStream RedisStream `json:"redisStream"`
+	Postgres    Postgres    `json:"postgres"`
+	Amqp        Amqp        `json:"amqp"`
+	Nats        Nats        `json:"nats"`
+	Kafka       Kafka       `json:"kafka"`
+}
+
+type Pusher struct {
+	Enabled         bool  `json:"enabled"`
+	ActivityTimeout int64 `json:"activityTimeout"`
+}
+
+type Cluster struct {
+	Adapter           string `json:"adapter"`
+	RequestTimeout    int64  `json:"requestTimeout"`
+	HeartbeatInterval int64  `json:"heartbeatInterval"`
+	NodeTimeout       int64  `json:"nodeTimeout"`
+}
+
+type ClientEventRule struct {
+	Channel string   `json:"channel"`
+	Events  []string `json:"events"`
+}
+
+type Channels struct {
+	Private      []string          `json:"private"`
+	Presence     []string          `json:"presence"`
+	ClientEvents []ClientEventRule `json:"clientEvents"`
+	CacheTtl     int64             `json:"cacheTtl"`
+}
+
+type Webhook struct {
+	Url    string   `json:"url"`
+	Events []string `json:"events"`
+}
+
+type Webhooks struct {
+	Enabled       bool      `json:"enabled"`
+	AppId         string    `json:"appId"`
+	Hooks         []Webhook `json:"hooks"`
+	BatchSize     int       `json:"batchSize"`
+	BatchInterval int64     `json:"batchInterval"`
+	MaxAttempts   int       `json:"maxAttempts"`
+	RetryDelay    int64     `json:"retryDelay"`
+}
+
+type History struct {
+	Enabled  bool     `json:"enabled"`
+	Driver   string   `json:"driver"`
+	Channels []string `json:"channels"`
+	Size     int      `json:"size"`
+	Ttl      int64    `json:"ttl"`
+}
+
+type Recovery struct {
+	Enabled                  bool  `json:"enabled"`
+	MaxDisconnectionDuration int64 `json:"maxDisconnectionDuration"`
+	BufferSize               int   `json:"bufferSize"`
+}
+
+type AuthRoute struct {
+	Channel      string            `json:"channel"`
+	Host         string            `json:"host"`
+	AuthEndpoint string            `json:"authEndpoint"`
+	Headers      map[string]string `json:"headers"`
+	Timeout      int64             `json:"timeout"`
+}
+
+type Jwt struct {
+	Enabled       bool     `json:"enabled"`
+	Secrets       []string `json:"secrets"`
+	JwksPath      string   `json:"jwksPath"`
+	Issuer        string   `json:"issuer"`
+	Audience      string   `json:"audience"`
+	ChannelsClaim string   `json:"channelsClaim"`
+	UserIdClaim   string   `json:"userIdClaim"`
+	UserInfoClaim string   `json:"userInfoClaim"`
+}
+
+type AuthCache struct {
+	Enabled    bool   `json:"enabled"`
+	Driver     string `json:"driver"`
+	Ttl        int64  `json:"ttl"`
+	UserHeader string `json:"userHeader"`
+}
+
+type HttpClient struct {
+	Timeout             int64 `json:"timeout"`
+	ConnectTimeout      int64 `json:"connectTimeout"`
+	MaxConnsPerHost     int   `json:"maxConnsPerHost"`
+	MaxIdleConnsPerHost int   `json:"maxIdleConnsPerHost"`
+	MaxConcurrent       int   `json:"maxConcurrent"`
+	Retries             int   `json:"retries"`
+	RetryDelay          int64 `json:"retryDelay"`
+	BreakerThreshold    int   `json:"breakerThreshold"`
+	BreakerCooldown     int64 `json:"breakerCooldown"`
 }
 
 type ApiOriginAllow struct {
@@ -43,21 +202,50 @@ type ApiOriginAllow struct {
 }
 
 type Config struct {
-	AuthHost       any               `json:"authHost"`
-	AuthEndpoint   string            `json:"authEndpoint"`
-	Clients        []Client          `json:"clients"`
-	Database       string            `json:"database"`
-	DatabaseConfig DatabaseConfig    `json:"databaseConfig"`
-	DevMode        bool              `json:"devMode"`
-	Host           any               `json:"host"`
-	Port           string            `json:"port"`
-	Protocol       string            `json:"protocol"`
-	Socketio       *ServerOptions    `json:"socketio"`
-	SslCertPath    string            `json:"sslCertPath"`
-	SslKeyPath     string            `json:"sslKeyPath"`
-	Subscribers    Subscribers       `json:"subscribers"`
-	ApiOriginAllow ApiOriginAllow    `json:"apiOriginAllow"`
-	Headers        map[string]string `json:"header"`
+	AuthHost         any               `json:"authHost"`
+	AuthEndpoint     string            `json:"authEndpoint"`
+	AuthRoutes       []AuthRoute       `json:"authRoutes"`
+	LocalAuth        bool              `json:"localAuth"`
+	Jwt              Jwt               `json:"jwt"`
+	AuthCache        AuthCache         `json:"authCache"`
+	HttpClient       HttpClient        `json:"httpClient"`
+	Clients          []Client          `json:"clients"`
+	Database         string            `json:"database"`
+	DatabaseConfig   DatabaseConfig    `json:"databaseConfig"`
+	DevMode          bool              `json:"devMode"`
+	Host             any               `json:"host"`
+	Port             string            `json:"port"`
+	Protocol         string            `json:"protocol"`
+	Socketio         *ServerOptions    `json:"socketio"`
+	SslCertPath      string            `json:"sslCertPath"`
+	SslKeyPath       string            `json:"sslKeyPath"`
+	Subscribers      Subscribers       `json:"subscribers"`
+	SubscriberConfig SubscriberConfig  `json:"subscriberConfig"`
+	Pusher           Pusher            `json:"pusher"`
+	Cluster          Cluster           `json:"cluster"`
+	Channels         Channels          `json:"channels"`
+	Webhooks         Webhooks          `json:"webhooks"`
+	History          History           `json:"history"`
+	Recovery         Recovery          `json:"recovery"`
+	ApiOriginAllow   ApiOriginAllow    `json:"apiOriginAllow"`
+	Headers          map[string]string `json:"header"`
+}
+
+// Decode a configuration file over the defaults, the options missing from the
+// file keep their default value, those of the nested options included.
+func Decode(_default *Config, data []byte) (*Config, error) {
+	config := &Config{}
+	if default_data, err := json.Marshal(_default); err != nil {
+		return nil, err
+	} else {
+		if err := json.Unmarshal(default_data, config); err != nil {
+			return nil, err
+		}
+	}
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, err
+	}
+	return config, nil
 }
 
 func Assign(_old *Config, _new *Config) (*Config, error) {
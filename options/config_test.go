@@ -0,0 +1,49 @@
+package options
+
+import (
+	"testing"
+)
+
+func TestDecodeKeepsDefaults(t *testing.T) {
+	_default := &Config{
+		Database: "sqlite",
+		Channels: Channels{Private: []string{"private-*"}, CacheTtl: 3600},
+		History:  History{Driver: "memory", Size: 100, Channels: []string{"*"}},
+	}
+
+	config, err := Decode(_default, []byte(`{"database": "redis", "channels": {"presence": ["room.*"]}, "history": {"enabled": true}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Database != "redis" {
+		t.Errorf("the database is %q", config.Database)
+	}
+	if len(config.Channels.Private) != 1 || config.Channels.Private[0] != "private-*" || config.Channels.CacheTtl != 3600 {
+		t.Errorf("the nested defaults are lost: %+v", config.Channels)
+	}
+	if len(config.Channels.Presence) != 1 || config.Channels.Presence[0] != "room.*" {
+		t.Errorf("the presence channels are %v", config.Channels.Presence)
+	}
+	if !config.History.Enabled || config.History.Driver != "memory" || config.History.Size != 100 {
+		t.Errorf("the history defaults are lost: %+v", config.History)
+	}
+	if _default.Database != "sqlite" || _default.History.Enabled {
+		t.Error("the defaults are changed")
+	}
+}
+
+func TestDecodeKeepsEmptyLists(t *testing.T) {
+	config, err := Decode(&Config{Channels: Channels{Private: []string{"private-*"}}}, []byte(`{"channels": {"private": []}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Channels.Private == nil || len(config.Channels.Private) != 0 {
+		t.Errorf("an empty list is replaced with %v", config.Channels.Private)
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	if _, err := Decode(&Config{}, []byte(`{"database": `)); err == nil {
+		t.Error("an invalid file is accepted")
+	}
+}
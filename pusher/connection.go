@@ -0,0 +1,512 @@
+package pusher
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/larisgo/laravel-echo-server/options"
+	"github.com/larisgo/laravel-echo-server/types"
+	"github.com/zishang520/engine.io/utils"
+)
+
+// Time allowed for a client to answer a ping after the activity timeout.
+const pongTimeout = 30 * time.Second
+
+// Maximum size of a message sent by a client.
+const maxMessageSize = 10 * 1024
+
+// Time allowed to write a message to a client.
+const writeTimeout = 10 * time.Second
+
+// Number of messages waiting to be written, a client falling further behind is disconnected.
+const sendBufferSize = 256
+
+// Number of subscriptions waiting for their authentication.
+const pendingSubscriptions = 100
+
+type Connection struct {
+
+	// The socket id.
+	id string
+
+	// The websocket connection.
+	conn *websocket.Conn
+
+	// The upgrade request.
+	request *http.Request
+
+	// The app the connection belongs to.
+	app options.Client
+
+	// Pusher server instance.
+	pusher *Pusher
+
+	// Joined channels, guarded by the pusher server.
+	channels map[string]struct{}
+
+	// Messages waiting to be written.
+	outbox chan *OutgoingMessage
+
+	// Events of the channels being subscribed, held until the subscription is confirmed
+	// since the Pusher libraries drop the events of a channel received before.
+	held   map[string][]*OutgoingMessage
+	heldMu sync.Mutex
+
+	// Subscriptions and unsubscriptions, handled in order away from the read loop.
+	tasks chan func()
+
+	// Activity of the client, delays the next ping.
+	active chan struct{}
+
+	// Closed once the connection is gone.
+	done chan struct{}
+
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// Create a new Pusher connection.
+func NewConnection(id string, conn *websocket.Conn, request *http.Request, app options.Client, pusher *Pusher) *Connection {
+	c := &Connection{}
+	c.id = id
+	c.conn = conn
+	c.request = request
+	c.app = app
+	c.pusher = pusher
+	c.channels = map[string]struct{}{}
+	c.outbox = make(chan *OutgoingMessage, sendBufferSize)
+	c.held = map[string][]*OutgoingMessage{}
+	c.tasks = make(chan func(), pendingSubscriptions)
+	c.active = make(chan struct{}, 1)
+	c.done = make(chan struct{})
+	return c
+}
+
+func (c *Connection) Id() string {
+	return c.id
+}
+
+func (c *Connection) Header(key string) string {
+	return c.request.Header.Get(key)
+}
+
+func (c *Connection) Join(channel string) {
+	c.pusher.join(c, channel)
+}
+
+func (c *Connection) Leave(channel string) {
+	c.pusher.leave(c, channel)
+}
+
+func (c *Connection) Has(channel string) bool {
+	return c.pusher.has(c, channel)
+}
+
+// Emit an event of a channel, translating the Echo events to the Pusher protocol.
+func (c *Connection) Emit(event string, channel string, data any) error {
+	switch event {
+	case "subscription_error":
+		status, _ := data.(int)
+		c.release(channel)
+		return c.send("pusher:subscription_error", channel, &SubscriptionErrorData{
+			Type:   "AuthError",
+			Error:  fmt.Sprintf("Unable to subscribe to channel %s", channel),
+			Status: status,
+		})
+	case "presence:subscribed":
+		members, _ := data.(types.Members)
+		presence := &PresenceData{
+			Ids:  []string{},
+			Hash: map[string]any{},
+		}
+		for _, member := range members {
+			userId := member.UserId.String()
+			presence.Ids = append(presence.Ids, userId)
+			presence.Hash[userId] = member.UserInfo
+		}
+		presence.Count = len(presence.Ids)
+		return c.confirm(channel, map[string]any{
+			"presence": presence,
+		})
+	case "cache_miss":
+		return c.send("pusher:cache_miss", channel, map[string]any{})
+	case "history:gap":
+		return c.send("pusher:history_gap", channel, data)
+	case "encrypted:subscribed":
+		// Pusher clients get the shared secret from their own auth request.
+		return nil
+	case "presence:joining":
+		if member, ok := toMember(data); ok {
+			return c.send("pusher_internal:member_added", channel, &MemberData{
+				UserId:   member.UserId.String(),
+				UserInfo: member.UserInfo,
+			})
+		}
+		return nil
+	case "presence:leaving":
+		if member, ok := toMember(data); ok {
+			return c.send("pusher_internal:member_removed", channel, &MemberData{
+				UserId: member.UserId.String(),
+			})
+		}
+		return nil
+	}
+	return c.send(event, channel, data)
+}
+
+// Emit an event of a channel numbered in its history, the sequence is sent next to the data.
+func (c *Connection) EmitSequenced(event string, channel string, data any, seq int64) error {
+	if seq <= 0 {
+		return c.Emit(event, channel, data)
+	}
+	return c.sendSequenced(event, channel, data, seq)
+}
+
+// Connections signing their private subscriptions are verified with the secret of the API client.
+func (c *Connection) SignsChannels() bool {
+	return true
+}
+
+// Get the API client of the app the connection belongs to.
+func (c *Connection) App() options.Client {
+	return c.app
+}
+
+// Read and handle messages until the connection is closed.
+func (c *Connection) Listen() {
+	defer c.disconnect()
+
+	c.conn.SetReadLimit(maxMessageSize)
+
+	c.wg.Add(2)
+	go c.writer()
+	go c.worker()
+
+	if err := c.send("pusher:connection_established", "", &ConnectionEstablishedData{
+		SocketId:        c.id,
+		ActivityTimeout: c.pusher.options.Pusher.ActivityTimeout,
+	}); err != nil {
+		return
+	}
+
+	for {
+		c.conn.SetReadDeadline(time.Now().Add(time.Duration(c.pusher.options.Pusher.ActivityTimeout)*time.Second + pongTimeout))
+
+		_, payload, err := c.conn.ReadMessage()
+		if err != nil {
+			if c.pusher.options.DevMode && websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				utils.Log().Error("%v", err)
+			}
+			return
+		}
+		select {
+		case c.active <- struct{}{}:
+		default:
+		}
+
+		var message *Message
+		if err := json.Unmarshal(payload, &message); err != nil || message == nil {
+			c.sendError(ErrorGeneric, "Invalid message format.")
+			continue
+		}
+		c.handle(message)
+	}
+}
+
+// Write the queued messages, and ping the client once it has been inactive for the activity timeout.
+func (c *Connection) writer() {
+	defer c.wg.Done()
+
+	activityTimeout := time.Duration(c.pusher.options.Pusher.ActivityTimeout) * time.Second
+	ping := time.NewTimer(activityTimeout)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case message := <-c.outbox:
+			c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if err := c.conn.WriteJSON(message); err != nil {
+				// The read loop fails as well and disconnects.
+				c.conn.Close()
+				return
+			}
+		case <-c.active:
+			if !ping.Stop() {
+				select {
+				case <-ping.C:
+				default:
+				}
+			}
+			ping.Reset(activityTimeout)
+		case <-ping.C:
+			c.send("pusher:ping", "", map[string]any{})
+		}
+	}
+}
+
+// Handle the subscriptions in order, their authentication may wait for the application.
+func (c *Connection) worker() {
+	defer c.wg.Done()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case task := <-c.tasks:
+			task()
+		}
+	}
+}
+
+// Queue a subscription change, the client is told when too many are pending.
+func (c *Connection) queue(task func()) {
+	select {
+	case c.tasks <- task:
+	default:
+		c.sendError(ErrorGeneric, "Too many pending subscriptions.")
+	}
+}
+
+// Handle a message sent by the client.
+func (c *Connection) handle(message *Message) {
+	switch message.Event {
+	case "pusher:ping":
+		c.send("pusher:pong", "", map[string]any{})
+	case "pusher:pong":
+		// The activity is noted by the read loop.
+	case "pusher:subscribe":
+		var data *SubscribeData
+		if err := json.Unmarshal(message.Data, &data); err != nil || data == nil {
+			c.sendError(ErrorGeneric, "Invalid subscribe data.")
+			return
+		}
+		c.queue(func() {
+			c.subscribe(data)
+		})
+	case "pusher:unsubscribe":
+		var data *UnsubscribeData
+		if err := json.Unmarshal(message.Data, &data); err != nil || data == nil {
+			c.sendError(ErrorGeneric, "Invalid unsubscribe data.")
+			return
+		}
+		c.queue(func() {
+			c.pusher.channel.Leave(c, data.Channel, "unsubscribed")
+		})
+	default:
+		var data any
+		if len(message.Data) > 0 {
+			if err := json.Unmarshal(message.Data, &data); err != nil {
+				c.sendError(ErrorGeneric, "Invalid event data.")
+				return
+			}
+		}
+		c.pusher.channel.ClientEvent(c, &types.Data{
+			Channel: message.Channel,
+			Event:   message.Event,
+			Data:    data,
+		})
+	}
+}
+
+// Subscribe the connection to a channel, the cached and missed events follow the confirmation.
+func (c *Connection) subscribe(data *SubscribeData) {
+	c.hold(data.Channel)
+	defer c.release(data.Channel)
+
+	c.pusher.channel.Join(c, &types.Data{
+		Channel: data.Channel,
+		Auth: types.Auth{
+			Headers:   map[string]string{},
+			Signature: data.Auth,
+		},
+		ChannelData: data.ChannelData,
+		Since:       data.Since,
+	})
+
+	// Presence channels confirm the subscription with their members.
+	if c.Has(data.Channel) && !c.pusher.channel.IsPresence(data.Channel) {
+		c.confirm(data.Channel, map[string]any{})
+	}
+}
+
+// Hold the events of a channel until its subscription is confirmed.
+func (c *Connection) hold(channel string) {
+	c.heldMu.Lock()
+	defer c.heldMu.Unlock()
+
+	if _, ok := c.held[channel]; !ok {
+		c.held[channel] = []*OutgoingMessage{}
+	}
+}
+
+// Confirm the subscription to a channel, then send the events held until now.
+func (c *Connection) confirm(channel string, data any) error {
+	message, err := c.message("pusher_internal:subscription_succeeded", channel, data, 0)
+	if err != nil {
+		return err
+	}
+
+	c.heldMu.Lock()
+	defer c.heldMu.Unlock()
+
+	held := c.held[channel]
+	delete(c.held, channel)
+	if err := c.enqueue(message); err != nil {
+		return err
+	}
+	for _, message := range held {
+		if err := c.enqueue(message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Drop the events held for a channel whose subscription was not confirmed.
+func (c *Connection) release(channel string) {
+	c.heldMu.Lock()
+	defer c.heldMu.Unlock()
+
+	delete(c.held, channel)
+}
+
+// Leave all channels once the connection is gone, after the pending subscription.
+func (c *Connection) disconnect() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+	})
+	c.wg.Wait()
+
+	for _, channel := range c.pusher.channelsOf(c) {
+		c.pusher.channel.Leave(c, channel, "transport close")
+	}
+	c.pusher.remove(c)
+	c.conn.Close()
+
+	if c.pusher.options.DevMode {
+		utils.Log().Info(`%s disconnected`, c.id)
+	}
+}
+
+// Close the connection with a close code.
+func (c *Connection) Close(code int, reason string) error {
+	c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(time.Second))
+	return c.conn.Close()
+}
+
+// Send an event to the client, Pusher events carry their data JSON encoded.
+func (c *Connection) send(event string, channel string, data any) error {
+	return c.sendSequenced(event, channel, data, 0)
+}
+
+// Send an event to the client with its history sequence, omitted when zero.
+func (c *Connection) sendSequenced(event string, channel string, data any, seq int64) error {
+	message, err := c.message(event, channel, data, seq)
+	if err != nil {
+		return err
+	}
+	return c.write(message)
+}
+
+// Build the message of an event, Pusher events carry their data JSON encoded.
+func (c *Connection) message(event string, channel string, data any, seq int64) (*OutgoingMessage, error) {
+	if _, ok := data.(string); !ok {
+		encoded, err := json.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+		data = string(encoded)
+	}
+	return &OutgoingMessage{
+		Event:   event,
+		Channel: channel,
+		Data:    data,
+		Seq:     seq,
+	}, nil
+}
+
+// Send a protocol error to the client.
+func (c *Connection) sendError(code int, message string) error {
+	return c.write(&OutgoingMessage{
+		Event: "pusher:error",
+		Data: &ErrorData{
+			Message: message,
+			Code:    code,
+		},
+	})
+}
+
+// Queue a message for the writer, or hold it while its channel is being subscribed.
+func (c *Connection) write(message *OutgoingMessage) error {
+	c.heldMu.Lock()
+	defer c.heldMu.Unlock()
+
+	if held, ok := c.held[message.Channel]; ok && message.Channel != "" {
+		if len(held) >= sendBufferSize {
+			return c.tooSlow()
+		}
+		c.held[message.Channel] = append(held, message)
+		return nil
+	}
+	return c.enqueue(message)
+}
+
+// Queue a message for the writer, a client too slow to keep up is disconnected.
+func (c *Connection) enqueue(message *OutgoingMessage) error {
+	select {
+	case <-c.done:
+		return errors.New("The connection is closed.")
+	default:
+	}
+	select {
+	case c.outbox <- message:
+		return nil
+	default:
+		return c.tooSlow()
+	}
+}
+
+// Disconnect a client too slow to keep up.
+func (c *Connection) tooSlow() error {
+	if c.pusher.options.DevMode {
+		utils.Log().Warning(`%s is too slow, disconnecting`, c.id)
+	}
+	c.Close(ErrorOverCapacity, "Too slow to receive the messages.")
+	return errors.New("The connection is too slow.")
+}
+
+// Get the member of a presence event, events relayed by other server nodes carry it decoded from JSON.
+func toMember(data any) (*types.Member, bool) {
+	if member, ok := data.(*types.Member); ok {
+		return member, true
+	}
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return nil, false
+	}
+	var member *types.Member
+	if err := json.Unmarshal(encoded, &member); err != nil || member == nil {
+		return nil, false
+	}
+	return member, true
+}
+
+// Send a protocol error to a connection that was refused and close it.
+func closeWithError(conn *websocket.Conn, code int, message string) {
+	conn.WriteJSON(&OutgoingMessage{
+		Event: "pusher:error",
+		Data: &ErrorData{
+			Message: message,
+			Code:    code,
+		},
+	})
+	conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, message), time.Now().Add(time.Second))
+	conn.Close()
+}
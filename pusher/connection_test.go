@@ -0,0 +1,76 @@
+package pusher
+
+import (
+	"testing"
+
+	"github.com/larisgo/laravel-echo-server/options"
+	"github.com/larisgo/laravel-echo-server/types"
+)
+
+func newTestConnection() *Connection {
+	return NewConnection("1.1", nil, nil, options.Client{}, NewPusher(nil, nil, &options.Config{}))
+}
+
+// Get the events of the messages queued for the writer.
+func queued(c *Connection) []string {
+	events := []string{}
+	for {
+		select {
+		case message := <-c.outbox:
+			events = append(events, message.Channel+":"+message.Event)
+		default:
+			return events
+		}
+	}
+}
+
+func expectEvents(t *testing.T, c *Connection, expected ...string) {
+	t.Helper()
+	events := queued(c)
+	if len(events) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, events)
+	}
+	for i := range expected {
+		if events[i] != expected[i] {
+			t.Fatalf("expected %v, got %v", expected, events)
+		}
+	}
+}
+
+func TestEventsFollowTheConfirmation(t *testing.T) {
+	c := newTestConnection()
+	c.hold("orders")
+
+	// The cached and replayed events are sent while subscribing.
+	c.EmitSequenced("OrderShipped", "orders", map[string]any{}, 3)
+	c.Emit("cache_miss", "orders", nil)
+	c.Emit("Published", "news", map[string]any{})
+	expectEvents(t, c, "news:Published")
+
+	c.confirm("orders", map[string]any{})
+	expectEvents(t, c, "orders:pusher_internal:subscription_succeeded", "orders:OrderShipped", "orders:pusher:cache_miss")
+
+	c.Emit("OrderShipped", "orders", map[string]any{})
+	expectEvents(t, c, "orders:OrderShipped")
+}
+
+func TestPresenceConfirmationReleasesEvents(t *testing.T) {
+	c := newTestConnection()
+	c.hold("presence-chat")
+	c.Emit("Typing", "presence-chat", map[string]any{})
+	c.Emit("presence:subscribed", "presence-chat", types.Members{{UserId: "1"}})
+	expectEvents(t, c, "presence-chat:pusher_internal:subscription_succeeded", "presence-chat:Typing")
+}
+
+func TestRefusedSubscriptionDropsEvents(t *testing.T) {
+	c := newTestConnection()
+	c.hold("private-orders")
+	c.Emit("OrderShipped", "private-orders", map[string]any{})
+	c.Emit("subscription_error", "private-orders", 403)
+	expectEvents(t, c, "private-orders:pusher:subscription_error")
+
+	c.hold("private-orders")
+	c.Emit("OrderShipped", "private-orders", map[string]any{})
+	c.release("private-orders")
+	expectEvents(t, c)
+}
@@ -0,0 +1,64 @@
+package pusher
+
+import (
+	"encoding/json"
+)
+
+// Pusher protocol error codes.
+const (
+	ErrorAppKeyNotFound      = 4001
+	ErrorUnsupportedProtocol = 4007
+	ErrorOverCapacity        = 4100
+	ErrorGeneric             = 4200
+)
+
+type Message struct {
+	Event   string          `json:"event"`
+	Channel string          `json:"channel,omitempty"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+type OutgoingMessage struct {
+	Event   string `json:"event"`
+	Channel string `json:"channel,omitempty"`
+	Data    any    `json:"data,omitempty"`
+	Seq     int64  `json:"seq,omitempty"`
+}
+
+type SubscribeData struct {
+	Channel     string `json:"channel"`
+	Auth        string `json:"auth"`
+	ChannelData string `json:"channel_data"`
+	Since       *int64 `json:"since,omitempty"`
+}
+
+type UnsubscribeData struct {
+	Channel string `json:"channel"`
+}
+
+type ConnectionEstablishedData struct {
+	SocketId        string `json:"socket_id"`
+	ActivityTimeout int64  `json:"activity_timeout"`
+}
+
+type ErrorData struct {
+	Message string `json:"message"`
+	Code    int    `json:"code"`
+}
+
+type SubscriptionErrorData struct {
+	Type   string `json:"type"`
+	Error  string `json:"error"`
+	Status int    `json:"status"`
+}
+
+type PresenceData struct {
+	Ids   []string       `json:"ids"`
+	Hash  map[string]any `json:"hash"`
+	Count int            `json:"count"`
+}
+
+type MemberData struct {
+	UserId   string `json:"user_id"`
+	UserInfo any    `json:"user_info,omitempty"`
+}
@@ -0,0 +1,254 @@
+package pusher
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/gorilla/websocket"
+	"github.com/julienschmidt/httprouter"
+	"github.com/larisgo/laravel-echo-server/channels"
+	"github.com/larisgo/laravel-echo-server/express"
+	"github.com/larisgo/laravel-echo-server/options"
+	"github.com/zishang520/engine.io/utils"
+)
+
+type Pusher struct {
+
+	// The server.
+	express *express.Express
+
+	// Channel instance.
+	channel *channels.Channel
+
+	// Configurable server options.
+	options *options.Config
+
+	// The websocket upgrader.
+	upgrader *websocket.Upgrader
+
+	// Open connections by socket id.
+	connections map[string]*Connection
+
+	// Subscribed connections by channel name.
+	rooms map[string]map[string]*Connection
+
+	mu sync.RWMutex
+}
+
+// Create a new Pusher protocol server instance.
+func NewPusher(channel *channels.Channel, express *express.Express, _options *options.Config) *Pusher {
+	p := &Pusher{}
+	p.channel = channel
+	p.express = express
+	p.options = _options
+	p.upgrader = &websocket.Upgrader{
+		CheckOrigin: func(r *http.Request) bool {
+			return true
+		},
+	}
+	p.connections = map[string]*Connection{}
+	p.rooms = map[string]map[string]*Connection{}
+	return p
+}
+
+// Mount the Pusher websocket endpoint.
+func (p *Pusher) Init() {
+	p.express.Route().GET("/app/:key", p.handle)
+
+	p.channel.Broadcaster.AddTransport(p)
+
+	utils.Log().Success("Listening for pusher connections...")
+}
+
+// Close all open connections.
+func (p *Pusher) Close() {
+	p.mu.RLock()
+	connections := make([]*Connection, 0, len(p.connections))
+	for _, connection := range p.connections {
+		connections = append(connections, connection)
+	}
+	p.mu.RUnlock()
+
+	for _, connection := range connections {
+		connection.Close(websocket.CloseGoingAway, "Server shutting down")
+	}
+}
+
+// Upgrade an incoming request to a Pusher connection.
+func (p *Pusher) handle(w http.ResponseWriter, r *http.Request, router httprouter.Params) {
+	conn, err := p.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		if p.options.DevMode {
+			utils.Log().Error("%v", err)
+		}
+		return
+	}
+
+	client, ok := p.findClient(router.ByName("key"))
+	if !ok {
+		closeWithError(conn, ErrorAppKeyNotFound, fmt.Sprintf("App key %s not in this cluster.", router.ByName("key")))
+		return
+	}
+	if !p.supportsProtocol(r.URL.Query().Get("protocol")) {
+		closeWithError(conn, ErrorUnsupportedProtocol, "Unsupported protocol version.")
+		return
+	}
+
+	id, err := p.generateSocketId()
+	if err != nil {
+		closeWithError(conn, ErrorGeneric, err.Error())
+		return
+	}
+
+	connection := NewConnection(id, conn, r, client, p)
+
+	p.mu.Lock()
+	p.connections[id] = connection
+	p.mu.Unlock()
+
+	if p.options.DevMode {
+		utils.Log().Info(`%s connected via pusher protocol`, id)
+	}
+
+	connection.Listen()
+}
+
+// Find the client with the given app key.
+func (p *Pusher) findClient(key string) (options.Client, bool) {
+	if key != "" {
+		for _, client := range p.options.Clients {
+			if client.Key == key {
+				return client, true
+			}
+		}
+	}
+	return options.Client{}, false
+}
+
+// Check if the protocol version requested by the client is supported.
+func (p *Pusher) supportsProtocol(protocol string) bool {
+	version, err := strconv.Atoi(protocol)
+	if err != nil {
+		return false
+	}
+	return version >= 5 && version <= 7
+}
+
+// Generate a socket id in the "1234.5678" format of Pusher.
+func (p *Pusher) generateSocketId() (string, error) {
+	data := make([]byte, 8)
+	if _, err := rand.Read(data); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d.%d", binary.BigEndian.Uint32(data[:4]), binary.BigEndian.Uint32(data[4:])), nil
+}
+
+// Subscribe a connection to a channel.
+func (p *Pusher) join(connection *Connection, channel string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, ok := p.rooms[channel]; !ok {
+		p.rooms[channel] = map[string]*Connection{}
+	}
+	p.rooms[channel][connection.Id()] = connection
+	connection.channels[channel] = struct{}{}
+}
+
+// Unsubscribe a connection from a channel.
+func (p *Pusher) leave(connection *Connection, channel string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if room, ok := p.rooms[channel]; ok {
+		delete(room, connection.Id())
+		if len(room) == 0 {
+			delete(p.rooms, channel)
+		}
+	}
+	delete(connection.channels, channel)
+}
+
+// Check if a connection has joined a channel.
+func (p *Pusher) has(connection *Connection, channel string) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	_, ok := connection.channels[channel]
+	return ok
+}
+
+// Get the channels a connection has joined.
+func (p *Pusher) channelsOf(connection *Connection) []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	channels := make([]string, 0, len(connection.channels))
+	for channel := range connection.channels {
+		channels = append(channels, channel)
+	}
+	return channels
+}
+
+// Remove a closed connection.
+func (p *Pusher) remove(connection *Connection) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	delete(p.connections, connection.Id())
+}
+
+// Emit an event to the connections of a channel, except the given connection id.
+func (p *Pusher) Emit(channel string, event string, data any, except string, seq int64) error {
+	p.mu.RLock()
+	connections := make([]*Connection, 0, len(p.rooms[channel]))
+	for id, connection := range p.rooms[channel] {
+		if id != except {
+			connections = append(connections, connection)
+		}
+	}
+	p.mu.RUnlock()
+
+	for _, connection := range connections {
+		if err := connection.EmitSequenced(event, channel, data, seq); err != nil && p.options.DevMode {
+			utils.Log().Error("%v", err)
+		}
+	}
+	return nil
+}
+
+// Get the ids of the connections subscribed to a channel.
+func (p *Pusher) Clients(channel string) []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	clients := make([]string, 0, len(p.rooms[channel]))
+	for id := range p.rooms[channel] {
+		clients = append(clients, id)
+	}
+	return clients
+}
+
+// Get the open channels and their subscription count.
+func (p *Pusher) Channels() map[string]int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	channels := map[string]int{}
+	for channel, room := range p.rooms {
+		channels[channel] = len(room)
+	}
+	return channels
+}
+
+// Get the number of open connections.
+func (p *Pusher) Count() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return len(p.connections)
+}
@@ -81,7 +81,7 @@ func (serv *Server) httpServer(secure bool) (err error) {
 
 	serv.server = types.CreateServer(serv.Express)
 
-	serv.Io = socket.NewServer(serv.server, serv.options.Socketio.Config())
+	serv.Io = socket.NewServer(serv.server, serv.socketOptions())
 
 	switch hosts := serv.options.Host.(type) {
 	case string:
@@ -96,6 +96,24 @@ func (serv *Server) httpServer(secure bool) (err error) {
 	return nil
 }
 
+// The Socket.io options, with its connection state recovery when the channels of the
+// disconnected connections are kept.
+func (serv *Server) socketOptions() *socket.ServerOptions {
+	config := serv.options.Socketio.Config()
+	if !serv.options.Recovery.Enabled {
+		return config
+	}
+	if config == nil {
+		config = socket.DefaultServerOptions()
+	}
+	recovery := &socket.ConnectionStateRecovery{}
+	recovery.SetMaxDisconnectionDuration(serv.options.Recovery.MaxDisconnectionDuration)
+	// The connection was authorized to its channels before the disconnect.
+	recovery.SetSkipMiddlewares(true)
+	config.SetConnectionStateRecovery(recovery)
+	return config
+}
+
 // Close
 func (serv *Server) Close() error {
 	return serv.server.Close(nil)
@@ -0,0 +1,203 @@
+package subscribers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/larisgo/laravel-echo-server/options"
+	"github.com/larisgo/laravel-echo-server/types"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/zishang520/engine.io/utils"
+)
+
+type AmqpSubscriber struct {
+
+	// Reports the state of the connection.
+	*reporter
+
+	// Configurable server options.
+	options *options.Config
+
+	// The current connection, closed to unsubscribe.
+	conn *amqp.Connection
+	mu   sync.Mutex
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// Create a new instance of subscriber.
+func NewAmqpSubscriber(_options *options.Config) (Subscriber, error) {
+	sub := &AmqpSubscriber{}
+	sub.reporter = newReporter("amqp")
+	sub.ctx, sub.cancel = context.WithCancel(context.Background())
+	sub.options = _options
+
+	config := _options.SubscriberConfig.Amqp
+	if config.Queue == "" && config.Exchange == "" {
+		return nil, errors.New("The amqp subscriber needs a queue or an exchange to consume from.")
+	}
+	conn, err := amqp.Dial(config.Url)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("AMQP connection failed: %v", err))
+	}
+	sub.conn = conn
+	return sub, nil
+}
+
+// Every server node consumes its own queue, unless they share a named one.
+func (sub *AmqpSubscriber) FansOut() bool {
+	return sub.options.SubscriberConfig.Amqp.Queue == ""
+}
+
+// Subscribe to events to broadcast, reconnecting until unsubscribed.
+func (sub *AmqpSubscriber) Subscribe(callback Broadcast) {
+	go func() {
+		defer sub.stop()
+
+		sub.report(StateConnecting, nil)
+		for attempt := 0; ; attempt++ {
+			ch, deliveries, err := sub.consume()
+			if err == nil {
+				attempt = 0
+				sub.report(StateConnected, nil)
+				err = sub.receive(ch, deliveries, callback)
+				ch.Close()
+			}
+			if sub.ctx.Err() != nil {
+				return
+			}
+			sub.report(StateReconnecting, err)
+			select {
+			case <-time.After(reconnectBackoff(attempt)):
+			case <-sub.ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Get the connection, reconnecting if it was lost.
+func (sub *AmqpSubscriber) connect() (*amqp.Connection, error) {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+
+	// Unsubscribed while reconnecting.
+	if sub.ctx.Err() != nil {
+		return nil, sub.ctx.Err()
+	}
+	if sub.conn == nil || sub.conn.IsClosed() {
+		conn, err := amqp.Dial(sub.options.SubscriberConfig.Amqp.Url)
+		if err != nil {
+			return nil, err
+		}
+		sub.conn = conn
+	}
+	return sub.conn, nil
+}
+
+// Declare the queue, bind it to the exchange and start consuming. A queue
+// without a name is declared for this server only and deleted with the connection.
+func (sub *AmqpSubscriber) consume() (*amqp.Channel, <-chan amqp.Delivery, error) {
+	conn, err := sub.connect()
+	if err != nil {
+		return nil, nil, err
+	}
+	ch, err := conn.Channel()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	deliveries, err := func() (<-chan amqp.Delivery, error) {
+		config := sub.options.SubscriberConfig.Amqp
+		if err := ch.Qos(config.Prefetch, 0, false); err != nil {
+			return nil, err
+		}
+
+		args := amqp.Table{}
+		if config.DeadLetterQueue != "" {
+			if _, err := ch.QueueDeclare(config.DeadLetterQueue, true, false, false, false, nil); err != nil {
+				return nil, err
+			}
+			// Rejected messages go through the default exchange, which routes by queue name.
+			args["x-dead-letter-exchange"] = ""
+			args["x-dead-letter-routing-key"] = config.DeadLetterQueue
+		}
+
+		durable := config.Queue != ""
+		queue, err := ch.QueueDeclare(config.Queue, durable, !durable, !durable, false, args)
+		if err != nil {
+			return nil, err
+		}
+		if config.Exchange != "" {
+			for _, key := range config.BindingKeys {
+				if err := ch.QueueBind(queue.Name, key, config.Exchange, false, nil); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return ch.Consume(queue.Name, "", false, !durable, false, false, nil)
+	}()
+	if err != nil {
+		ch.Close()
+		return nil, nil, err
+	}
+	return ch, deliveries, nil
+}
+
+// Broadcast the delivered messages until the channel is closed.
+func (sub *AmqpSubscriber) receive(ch *amqp.Channel, deliveries <-chan amqp.Delivery, callback Broadcast) error {
+	closed := ch.NotifyClose(make(chan *amqp.Error, 1))
+	for delivery := range deliveries {
+		sub.broadcast(delivery, callback)
+	}
+	if err := <-closed; err != nil {
+		return err
+	}
+	return errors.New("The AMQP channel was closed.")
+}
+
+// Broadcast a message on the channel of its routing key and acknowledge it.
+// Malformed messages are rejected to the dead-letter queue.
+func (sub *AmqpSubscriber) broadcast(delivery amqp.Delivery, callback Broadcast) {
+	var message *types.Data
+	if err := json.Unmarshal(delivery.Body, &message); err != nil || message == nil {
+		utils.Log().Error("Rejected malformed amqp message %s: %v", delivery.RoutingKey, err)
+		delivery.Nack(false, false)
+		return
+	}
+
+	channel := strings.TrimPrefix(delivery.RoutingKey, sub.options.SubscriberConfig.Amqp.KeyPrefix)
+	// The routing key of a message published straight to the queue is the queue name.
+	if delivery.Exchange == "" {
+		channel = message.Channel
+	}
+	if channel == "" {
+		utils.Log().Error("Rejected amqp message %s without channel", delivery.RoutingKey)
+		delivery.Nack(false, false)
+		return
+	}
+
+	if sub.options.DevMode {
+		utils.Log().Info("Channel: " + channel)
+		utils.Log().Info("Event: " + message.Event)
+	}
+	callback(channel, message)
+	delivery.Ack(false)
+}
+
+// Unsubscribe from events to broadcast.
+func (sub *AmqpSubscriber) UnSubscribe() {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+
+	sub.cancel()
+	if sub.conn != nil {
+		sub.conn.Close()
+	}
+}
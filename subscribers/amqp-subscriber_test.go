@@ -0,0 +1,86 @@
+package subscribers
+
+import (
+	"testing"
+
+	"github.com/larisgo/laravel-echo-server/options"
+	"github.com/larisgo/laravel-echo-server/types"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Records the acknowledgements of the deliveries, after the broadcasts they follow.
+type recordingAcknowledger struct {
+	log *[]string
+}
+
+func (a *recordingAcknowledger) Ack(tag uint64, multiple bool) error {
+	*a.log = append(*a.log, "ack")
+	return nil
+}
+
+func (a *recordingAcknowledger) Nack(tag uint64, multiple bool, requeue bool) error {
+	if requeue {
+		*a.log = append(*a.log, "requeue")
+	} else {
+		*a.log = append(*a.log, "dead-letter")
+	}
+	return nil
+}
+
+func (a *recordingAcknowledger) Reject(tag uint64, requeue bool) error {
+	return a.Nack(tag, false, requeue)
+}
+
+func TestAmqpBroadcast(t *testing.T) {
+	_options := &options.Config{}
+	_options.SubscriberConfig.Amqp = options.Amqp{Exchange: "events", KeyPrefix: "echo."}
+	sub := &AmqpSubscriber{options: _options}
+
+	for _, test := range []struct {
+		name       string
+		exchange   string
+		routingKey string
+		body       string
+		log        []string
+	}{
+		{"routing key", "events", "echo.private-orders.1", `{"event":"OrderShipped","data":{}}`, []string{"private-orders.1:OrderShipped", "ack"}},
+		{"routing key without prefix", "events", "news", `{"event":"Published","data":{}}`, []string{"news:Published", "ack"}},
+		{"queue", "", "echo-events", `{"channel":"news","event":"Published","data":{}}`, []string{"news:Published", "ack"}},
+		{"queue without channel", "", "echo-events", `{"event":"Published","data":{}}`, []string{"dead-letter"}},
+		{"malformed", "events", "echo.news", `{"event":`, []string{"dead-letter"}},
+		{"null", "events", "echo.news", `null`, []string{"dead-letter"}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			log := []string{}
+			delivery := amqp.Delivery{
+				Acknowledger: &recordingAcknowledger{log: &log},
+				Exchange:     test.exchange,
+				RoutingKey:   test.routingKey,
+				Body:         []byte(test.body),
+			}
+			sub.broadcast(delivery, func(channel string, message *types.Data) {
+				log = append(log, channel+":"+message.Event)
+			})
+			if len(log) != len(test.log) {
+				t.Fatalf("expected %v, got %v", test.log, log)
+			}
+			for i := range log {
+				if log[i] != test.log[i] {
+					t.Fatalf("expected %v, got %v", test.log, log)
+				}
+			}
+		})
+	}
+}
+
+func TestAmqpFansOut(t *testing.T) {
+	_options := &options.Config{}
+	_options.SubscriberConfig.Amqp = options.Amqp{Exchange: "events"}
+	if !(&AmqpSubscriber{options: _options}).FansOut() {
+		t.Fatal("the queues of each server node do not fan out")
+	}
+	_options.SubscriberConfig.Amqp.Queue = "echo-events"
+	if (&AmqpSubscriber{options: _options}).FansOut() {
+		t.Fatal("a shared queue fans out")
+	}
+}
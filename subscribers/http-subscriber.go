@@ -3,18 +3,27 @@ package subscribers
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"strings"
 	"sync"
 
 	"github.com/julienschmidt/httprouter"
+	"github.com/larisgo/laravel-echo-server/channels"
 	"github.com/larisgo/laravel-echo-server/express"
 	"github.com/larisgo/laravel-echo-server/options"
 	"github.com/larisgo/laravel-echo-server/types"
 	"github.com/zishang520/engine.io/utils"
 )
 
+// The limits of the Pusher HTTP API on a batch of events.
+const (
+	maxBatchEvents   = 10
+	maxEventDataSize = 10 * 1024
+)
+
 type HttpSubscriber struct {
 
 	// The server.
@@ -49,6 +58,17 @@ func (sub *HttpSubscriber) Subscribe(callback Broadcast) {
 		}
 	}))
 
+	// Broadcast many messages with a single request
+	sub.express.Route().POST("/apps/:appId/batch_events", sub.express.AuthorizeRequests(func(w http.ResponseWriter, r *http.Request, router httprouter.Params) {
+
+		if sub.unSubscribed() {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write(nil)
+		} else {
+			sub.handleBatchData(w, r, router, callback)
+		}
+	}))
+
 	utils.Log().Success("Listening for http events...")
 }
 
@@ -84,46 +104,144 @@ func (sub *HttpSubscriber) handleData(w http.ResponseWriter, r *http.Request, ro
 		sub.badResponse(w, r, err.Error())
 		return
 	}
-	if (len(body.Channels) > 0 || body.Channel != "") && body.Name != "" && body.Data != "" {
-		var data any
-		if err := json.Unmarshal([]byte(body.Data), &data); err != nil {
+	channels, message, err := sub.parseEvent(&body)
+	if err != nil {
+		sub.badResponse(w, r, err.Error())
+		return
+	}
+	sub.broadcast(channels, message, broadcast)
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	io.WriteString(w, `{"message":"ok"}`)
+}
+
+// Handle incoming batch event data, each event is validated on its own.
+func (sub *HttpSubscriber) handleBatchData(w http.ResponseWriter, r *http.Request, router httprouter.Params, broadcast Broadcast) {
+	data := bytes.NewBuffer(nil)
+
+	if bd, ok := r.Body.(io.ReadCloser); ok && bd != nil {
+		data.ReadFrom(bd)
+		bd.Close()
+	} else {
+		sub.badResponse(w, r, `Batch must include a list of events`)
+		return
+	}
+
+	var body HttpSubscriberBatchData
+	if trimmed := bytes.TrimSpace(data.Bytes()); len(trimmed) > 0 && trimmed[0] == '[' {
+		// A bare list of events.
+		if err := json.Unmarshal(trimmed, &body.Batch); err != nil {
 			sub.badResponse(w, r, err.Error())
 			return
 		}
-
-		message := &types.Data{
-			Event:  body.Name,
-			Data:   data,
-			Socket: body.SocketId,
+	} else if err := json.Unmarshal(trimmed, &body); err != nil {
+		sub.badResponse(w, r, err.Error())
+		return
+	}
+	if len(body.Batch) == 0 {
+		sub.badResponse(w, r, `Batch must include a list of events`)
+		return
+	}
+	// The limits apply to the whole batch, none of its events is broadcast.
+	if len(body.Batch) > maxBatchEvents {
+		sub.badResponse(w, r, fmt.Sprintf(`Batch must not include more than %d events`, maxBatchEvents))
+		return
+	}
+	for i, event := range body.Batch {
+		if event != nil && len(event.Data) > maxEventDataSize {
+			sub.errorResponse(w, r, http.StatusRequestEntityTooLarge, fmt.Sprintf(`The data of event %d must not exceed %d bytes`, i, maxEventDataSize))
+			return
 		}
-		channels := []string{}
-		if len(body.Channels) > 0 {
-			channels = body.Channels
-		} else {
-			channels = []string{body.Channel}
+	}
+
+	results := make([]map[string]any, len(body.Batch))
+	for i, event := range body.Batch {
+		results[i] = map[string]any{}
+		channels, message, err := sub.parseEvent(event)
+		if err != nil {
+			results[i]["error"] = err.Error()
+			continue
 		}
+		sub.broadcast(channels, message, broadcast)
+	}
+
+	response, err := json.Marshal(map[string]any{
+		"batch": results,
+	})
+	if err != nil {
+		sub.badResponse(w, r, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(response)
+}
+
+// Validate an event and build the message to broadcast.
+func (sub *HttpSubscriber) parseEvent(body *HttpSubscriberData) ([]string, *types.Data, error) {
+	if body == nil || (len(body.Channels) == 0 && body.Channel == "") || body.Name == "" || body.Data == "" {
+		return nil, nil, errors.New(`Event must include channel, event name and data`)
+	}
+
+	channels := []string{}
+	if len(body.Channels) > 0 {
+		channels = body.Channels
+	} else {
+		channels = []string{body.Channel}
+	}
 
-		if sub.options.DevMode {
-			utils.Log().Info("Channel: " + sub.join(channels, ", "))
-			utils.Log().Info("Event: " + message.Event)
+	var data any
+	if sub.encrypted(channels) {
+		// The encrypted {nonce, ciphertext} payload is forwarded as sent.
+		if len(channels) > 1 {
+			return nil, nil, errors.New(`Events of encrypted channels must be sent to a single channel`)
 		}
-		for _, channel := range channels {
-			// sync
-			broadcast(channel, message)
+		if !json.Valid([]byte(body.Data)) {
+			return nil, nil, errors.New(`Event data must be valid JSON`)
 		}
-	} else {
-		sub.badResponse(w, r, `Event must include channel, event name and data`)
-		return
+		data = json.RawMessage(body.Data)
+	} else if err := json.Unmarshal([]byte(body.Data), &data); err != nil {
+		return nil, nil, err
 	}
 
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	io.WriteString(w, `{"message":"ok"}`)
+	message := &types.Data{
+		Event:  body.Name,
+		Data:   data,
+		Socket: body.SocketId,
+	}
+	return channels, message, nil
+}
+
+// Check if any of the channels is encrypted.
+func (sub *HttpSubscriber) encrypted(names []string) bool {
+	for _, name := range names {
+		if channels.IsEncrypted(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Broadcast a message to its channels.
+func (sub *HttpSubscriber) broadcast(channels []string, message *types.Data, broadcast Broadcast) {
+	if sub.options.DevMode {
+		utils.Log().Info("Channel: " + sub.join(channels, ", "))
+		utils.Log().Info("Event: " + message.Event)
+	}
+	for _, channel := range channels {
+		// sync
+		broadcast(channel, message)
+	}
 }
 
 // Handle bad Request.
 func (sub *HttpSubscriber) badResponse(w http.ResponseWriter, r *http.Request, message string) {
+	sub.errorResponse(w, r, http.StatusBadRequest, message)
+}
+
+// Respond with an error status and message.
+func (sub *HttpSubscriber) errorResponse(w http.ResponseWriter, r *http.Request, status int, message string) {
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	w.WriteHeader(http.StatusBadRequest)
+	w.WriteHeader(status)
 	data, _ := json.Marshal(map[string]any{
 		"error": message,
 	})
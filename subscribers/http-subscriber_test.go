@@ -0,0 +1,137 @@
+package subscribers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/larisgo/laravel-echo-server/express"
+	"github.com/larisgo/laravel-echo-server/options"
+	"github.com/larisgo/laravel-echo-server/types"
+)
+
+type broadcastEvent struct {
+	channel string
+	data    *types.Data
+}
+
+// Post a batch and return the response status, its body and the broadcast events.
+func postBatch(t *testing.T, body string) (int, map[string]any, []broadcastEvent) {
+	t.Helper()
+	_options := &options.Config{}
+	sub := NewHttpSubscriber(express.NewExpress(_options), _options).(*HttpSubscriber)
+
+	events := []broadcastEvent{}
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/apps/1/batch_events", strings.NewReader(body))
+	sub.handleBatchData(w, r, nil, func(channel string, data *types.Data) {
+		events = append(events, broadcastEvent{channel, data})
+	})
+
+	response := map[string]any{}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("invalid response %q: %v", w.Body.String(), err)
+	}
+	return w.Code, response, events
+}
+
+func TestBatchEventsValidatesEachEvent(t *testing.T) {
+	status, response, events := postBatch(t, `{"batch": [
+		{"channel": "orders", "name": "OrderShipped", "data": "{\"id\":1}"},
+		{"channel": "orders", "name": "", "data": "{}"},
+		{"channel": "orders", "name": "OrderShipped", "data": "{invalid"},
+		{"channels": ["a", "b"], "name": "Updated", "data": "[]", "socket_id": "s1"}
+	]}`)
+	if status != http.StatusOK {
+		t.Fatalf("unexpected status %d", status)
+	}
+
+	results, _ := response["batch"].([]any)
+	if len(results) != 4 {
+		t.Fatalf("expected a result for each event, got %v", response)
+	}
+	for i, failed := range []bool{false, true, true, false} {
+		_, hasError := results[i].(map[string]any)["error"]
+		if hasError != failed {
+			t.Errorf("event %d: error %v, expected %v", i, results[i], failed)
+		}
+	}
+
+	if len(events) != 3 {
+		t.Fatalf("expected the valid events to be broadcast to 3 channels, got %d", len(events))
+	}
+	if events[0].channel != "orders" || events[1].channel != "a" || events[2].channel != "b" {
+		t.Errorf("unexpected channels %v", events)
+	}
+	if events[2].data.Socket != "s1" {
+		t.Errorf("the socket id is lost, got %q", events[2].data.Socket)
+	}
+}
+
+func TestBatchEventsAcceptsList(t *testing.T) {
+	status, _, events := postBatch(t, `[{"channel": "orders", "name": "OrderShipped", "data": "{}"}]`)
+	if status != http.StatusOK || len(events) != 1 {
+		t.Fatalf("unexpected status %d with %d events", status, len(events))
+	}
+}
+
+func TestBatchEventsRefusesEmptyBatch(t *testing.T) {
+	for _, body := range []string{`{"batch": []}`, `{}`, `[]`, `{"batch": `} {
+		if status, _, events := postBatch(t, body); status != http.StatusBadRequest || len(events) != 0 {
+			t.Errorf("%s: unexpected status %d with %d events", body, status, len(events))
+		}
+	}
+}
+
+func TestBatchEventsEncryptedChannels(t *testing.T) {
+	_, response, events := postBatch(t, `{"batch": [
+		{"channels": ["private-encrypted-a", "private-encrypted-b"], "name": "Secret", "data": "{}"},
+		{"channel": "private-encrypted-a", "name": "Secret", "data": "{\"nonce\":\"n\",\"ciphertext\":\"c\"}"}
+	]}`)
+	results := response["batch"].([]any)
+	if _, ok := results[0].(map[string]any)["error"]; !ok {
+		t.Error("an encrypted event sent to several channels is accepted")
+	}
+	if len(events) != 1 {
+		t.Fatalf("expected one broadcast, got %d", len(events))
+	}
+	if data, ok := events[0].data.Data.(json.RawMessage); !ok || string(data) != `{"nonce":"n","ciphertext":"c"}` {
+		t.Errorf("the encrypted payload is not forwarded as sent, got %v", events[0].data.Data)
+	}
+}
+
+// Build a batch of events with data of the given size.
+func batchOf(count int, size int) string {
+	data, _ := json.Marshal(`"` + strings.Repeat("a", size-2) + `"`)
+	events := []string{}
+	for i := 0; i < count; i++ {
+		events = append(events, `{"channel": "orders", "name": "Updated", "data": `+string(data)+`}`)
+	}
+	return `{"batch": [` + strings.Join(events, ",") + `]}`
+}
+
+func TestBatchEventsLimits(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"10 events", batchOf(10, 10), http.StatusOK},
+		{"11 events", batchOf(11, 10), http.StatusBadRequest},
+		{"10KB of data", batchOf(1, 10*1024), http.StatusOK},
+		{"over 10KB of data", batchOf(1, 10*1024+1), http.StatusRequestEntityTooLarge},
+		// The limits come before the validation of each event.
+		{"11 invalid events", `[{}, {}, {}, {}, {}, {}, {}, {}, {}, {}, {}]`, http.StatusBadRequest},
+		{"large data of an invalid event", strings.Replace(batchOf(2, 10*1024+1), `"name": "Updated"`, `"name": ""`, 1), http.StatusRequestEntityTooLarge},
+	} {
+		status, response, events := postBatch(t, test.body)
+		if status != test.status {
+			t.Errorf("%s: expected the status %d, got %d %v", test.name, test.status, status, response)
+		}
+		if status != http.StatusOK && len(events) != 0 {
+			t.Errorf("%s: %d events of a refused batch are broadcast", test.name, len(events))
+		}
+	}
+}
@@ -1,5 +1,10 @@
 package subscribers
 
+import (
+	"encoding/json"
+	"time"
+)
+
 type HttpSubscriberData struct {
 	Channels []string `json:"channels"`
 	Channel  string   `json:"channel"`
@@ -7,3 +12,18 @@ type HttpSubscriberData struct {
 	Data     string   `json:"data"`
 	SocketId string   `json:"socket_id"`
 }
+
+type HttpSubscriberBatchData struct {
+	Batch []*HttpSubscriberData `json:"batch"`
+}
+
+type PostgresPayloadReference struct {
+	PayloadId json.RawMessage `json:"payload_id"`
+}
+
+type Status struct {
+	Subscriber string    `json:"subscriber"`
+	State      string    `json:"state"`
+	Error      string    `json:"error,omitempty"`
+	Since      time.Time `json:"since"`
+}
@@ -0,0 +1,209 @@
+package subscribers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/larisgo/laravel-echo-server/options"
+	"github.com/larisgo/laravel-echo-server/types"
+	"github.com/segmentio/kafka-go"
+	"github.com/zishang520/engine.io/utils"
+)
+
+type KafkaSubscriber struct {
+
+	// Reports the state of the connection.
+	*reporter
+
+	// Consumer group reader, reconnecting on its own.
+	reader kafkaReader
+
+	// Configurable server options.
+	options *options.Config
+
+	// Set while the reader reports errors, until a message is read again.
+	failing int32
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// The consumer group reader of the subscriber.
+type kafkaReader interface {
+	FetchMessage(context.Context) (kafka.Message, error)
+	CommitMessages(context.Context, ...kafka.Message) error
+	Close() error
+}
+
+// Create a new instance of subscriber.
+func NewKafkaSubscriber(_options *options.Config) (Subscriber, error) {
+	sub := &KafkaSubscriber{}
+	sub.reporter = newReporter("kafka")
+	sub.ctx, sub.cancel = context.WithCancel(context.Background())
+	sub.options = _options
+
+	config := _options.SubscriberConfig.Kafka
+	if len(config.Brokers) == 0 || len(config.Topics) == 0 {
+		return nil, errors.New("The kafka subscriber needs brokers and topics.")
+	}
+	if config.GroupId == "" {
+		return nil, errors.New("The kafka subscriber needs a group id.")
+	}
+	startOffset := kafka.LastOffset
+	switch config.StartOffset {
+	case "earliest":
+		startOffset = kafka.FirstOffset
+	case "", "latest":
+	default:
+		return nil, errors.New(fmt.Sprintf("Unknown kafka start offset %q, use earliest or latest.", config.StartOffset))
+	}
+
+	// The reader retries on its own, check a broker is reachable right away.
+	var err error
+	for _, broker := range config.Brokers {
+		var conn *kafka.Conn
+		if conn, err = kafka.DialContext(sub.ctx, "tcp", broker); err == nil {
+			conn.Close()
+			break
+		}
+	}
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Kafka connection failed: %v", err))
+	}
+
+	sub.reader = kafka.NewReader(kafka.ReaderConfig{
+		Brokers:     config.Brokers,
+		GroupID:     config.GroupId,
+		GroupTopics: config.Topics,
+		StartOffset: startOffset,
+		MaxWait:     time.Second,
+		ErrorLogger: kafka.LoggerFunc(sub.onError),
+	})
+	return sub, nil
+}
+
+// Report the errors of the reader, it retries on its own.
+func (sub *KafkaSubscriber) onError(message string, args ...any) {
+	if sub.ctx.Err() != nil {
+		return
+	}
+	atomic.StoreInt32(&sub.failing, 1)
+	sub.report(StateReconnecting, errors.New(fmt.Sprintf(message, args...)))
+}
+
+// Subscribe to events to broadcast. The messages are broadcast one at a time,
+// so those of a partition are broadcast in order, and committed in batches once
+// broadcast.
+func (sub *KafkaSubscriber) Subscribe(callback Broadcast) {
+	sub.wg.Add(1)
+	go func() {
+		defer sub.wg.Done()
+		defer sub.stop()
+		// The reader reports no more once closed.
+		defer sub.reader.Close()
+
+		// The broadcast messages not committed yet, and when they are due.
+		pending := []kafka.Message{}
+		var due time.Time
+		defer func() { sub.commit(pending) }()
+
+		sub.report(StateConnected, nil)
+		for attempt := 0; ; attempt++ {
+			msg, err := sub.fetch(len(pending) > 0, due)
+			if err == nil {
+				attempt = 0
+				if atomic.CompareAndSwapInt32(&sub.failing, 1, 0) {
+					sub.report(StateConnected, nil)
+				}
+				sub.broadcast(msg, callback)
+				if len(pending) == 0 {
+					due = time.Now().Add(time.Duration(sub.options.SubscriberConfig.Kafka.CommitInterval) * time.Millisecond)
+				}
+				pending = append(pending, msg)
+			} else if errors.Is(err, context.DeadlineExceeded) && sub.ctx.Err() == nil {
+				// The pending messages are due.
+				err = nil
+			}
+			if sub.ctx.Err() != nil {
+				return
+			}
+			// A message not committed is read again after a rebalance or a restart.
+			if err == nil && len(pending) > 0 && (len(pending) >= sub.options.SubscriberConfig.Kafka.CommitBatch || !time.Now().Before(due)) {
+				if err = sub.reader.CommitMessages(sub.ctx, pending...); err == nil {
+					pending = pending[:0]
+				}
+			}
+			if sub.ctx.Err() != nil {
+				return
+			}
+			if err == nil {
+				continue
+			}
+			atomic.StoreInt32(&sub.failing, 1)
+			sub.report(StateReconnecting, err)
+			select {
+			case <-time.After(reconnectBackoff(attempt)):
+			case <-sub.ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Fetch the next message, waiting no longer than the pending messages are due.
+func (sub *KafkaSubscriber) fetch(pending bool, due time.Time) (kafka.Message, error) {
+	if !pending {
+		return sub.reader.FetchMessage(sub.ctx)
+	}
+	ctx, cancel := context.WithDeadline(sub.ctx, due)
+	defer cancel()
+	return sub.reader.FetchMessage(ctx)
+}
+
+// Commit the broadcast messages once unsubscribed, they would be broadcast again otherwise.
+func (sub *KafkaSubscriber) commit(pending []kafka.Message) {
+	if len(pending) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := sub.reader.CommitMessages(ctx, pending...); err != nil {
+		utils.Log().Error("Unable to commit the broadcast kafka messages: %v", err)
+	}
+}
+
+// Broadcast a message on the channel of its header, or of its key if it has
+// no such header. Malformed messages are skipped.
+func (sub *KafkaSubscriber) broadcast(msg kafka.Message, callback Broadcast) {
+	channel := string(msg.Key)
+	for _, header := range msg.Headers {
+		if header.Key == sub.options.SubscriberConfig.Kafka.ChannelHeader {
+			channel = string(header.Value)
+			break
+		}
+	}
+
+	var message *types.Data
+	if err := json.Unmarshal(msg.Value, &message); err != nil || message == nil || channel == "" {
+		utils.Log().Error("Skipped malformed kafka message %s/%d@%d: %v", msg.Topic, msg.Partition, msg.Offset, err)
+		return
+	}
+	if sub.options.DevMode {
+		utils.Log().Info("Channel: " + channel)
+		utils.Log().Info("Event: " + message.Event)
+	}
+	callback(channel, message)
+}
+
+// Unsubscribe from events to broadcast, once the broadcast messages are committed.
+func (sub *KafkaSubscriber) UnSubscribe() {
+	sub.cancel()
+	sub.wg.Wait()
+	sub.reader.Close()
+}
@@ -0,0 +1,151 @@
+package subscribers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/larisgo/laravel-echo-server/options"
+	"github.com/larisgo/laravel-echo-server/types"
+	"github.com/segmentio/kafka-go"
+)
+
+// A reader of the queued messages, recording the commits.
+type fakeKafkaReader struct {
+	messages chan kafka.Message
+
+	// The offsets of each commit, and the number of broadcasts before it.
+	commits    [][]int64
+	broadcasts []int
+	broadcast  *int
+	mu         sync.Mutex
+}
+
+func (r *fakeKafkaReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	select {
+	case msg := <-r.messages:
+		return msg, nil
+	case <-ctx.Done():
+		return kafka.Message{}, ctx.Err()
+	}
+}
+
+func (r *fakeKafkaReader) CommitMessages(ctx context.Context, msgs ...kafka.Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	offsets := []int64{}
+	for _, msg := range msgs {
+		offsets = append(offsets, msg.Offset)
+	}
+	r.commits = append(r.commits, offsets)
+	r.broadcasts = append(r.broadcasts, *r.broadcast)
+	return nil
+}
+
+func (r *fakeKafkaReader) Close() error { return nil }
+
+func (r *fakeKafkaReader) committed() ([][]int64, []int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.commits, r.broadcasts
+}
+
+// Subscribe to the messages of a fake reader, committed by the given batch and interval.
+func newTestKafkaSubscriber(t *testing.T, batch int, interval int64) (*KafkaSubscriber, *fakeKafkaReader, chan string) {
+	t.Helper()
+	_options := &options.Config{}
+	_options.SubscriberConfig.Kafka = options.Kafka{ChannelHeader: "channel", CommitBatch: batch, CommitInterval: interval}
+	reader := &fakeKafkaReader{messages: make(chan kafka.Message, 100), broadcast: new(int)}
+	sub := &KafkaSubscriber{reporter: newReporter("kafka"), reader: reader, options: _options}
+	sub.ctx, sub.cancel = context.WithCancel(context.Background())
+
+	received := make(chan string, 100)
+	sub.Subscribe(func(channel string, message *types.Data) {
+		reader.mu.Lock()
+		*reader.broadcast++
+		reader.mu.Unlock()
+		received <- channel + ":" + message.Event
+	})
+	return sub, reader, received
+}
+
+func queueKafkaMessage(reader *fakeKafkaReader, offset int64, value string) {
+	reader.messages <- kafka.Message{
+		Partition: 0,
+		Offset:    offset,
+		Key:       []byte("private-orders.1"),
+		Headers:   []kafka.Header{{Key: "channel", Value: []byte("orders")}},
+		Value:     []byte(value),
+	}
+}
+
+func waitBroadcasts(t *testing.T, received chan string, count int) []string {
+	t.Helper()
+	events := []string{}
+	for len(events) < count {
+		select {
+		case event := <-received:
+			events = append(events, event)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected %d broadcasts, got %v", count, events)
+		}
+	}
+	return events
+}
+
+func TestKafkaCommitsInBatches(t *testing.T) {
+	sub, reader, received := newTestKafkaSubscriber(t, 3, 3600000)
+	for i := int64(0); i < 7; i++ {
+		value := fmt.Sprintf(`{"event":"OrderShipped.%d","data":{}}`, i)
+		if i == 4 {
+			value = `{"event":`
+		}
+		queueKafkaMessage(reader, i, value)
+	}
+	events := waitBroadcasts(t, received, 6)
+	for i, event := range []string{"orders:OrderShipped.0", "orders:OrderShipped.1", "orders:OrderShipped.2", "orders:OrderShipped.3", "orders:OrderShipped.5", "orders:OrderShipped.6"} {
+		if events[i] != event {
+			t.Fatalf("the messages are broadcast out of order: %v", events)
+		}
+	}
+
+	sub.UnSubscribe()
+	commits, broadcasts := reader.committed()
+	expected := [][]int64{{0, 1, 2}, {3, 4, 5}, {6}}
+	if fmt.Sprint(commits) != fmt.Sprint(expected) {
+		t.Fatalf("expected the commits %v, got %v", expected, commits)
+	}
+	// The malformed message is skipped, but committed.
+	for i, count := range []int{3, 5, 6} {
+		if broadcasts[i] != count {
+			t.Fatalf("the commit %v is not made after the broadcasts, %v", commits[i], broadcasts)
+		}
+	}
+}
+
+func TestKafkaCommitsOnInterval(t *testing.T) {
+	sub, reader, received := newTestKafkaSubscriber(t, 100, 20)
+	defer sub.UnSubscribe()
+
+	queueKafkaMessage(reader, 0, `{"event":"OrderShipped","data":{}}`)
+	queueKafkaMessage(reader, 1, `{"event":"OrderShipped","data":{}}`)
+	waitBroadcasts(t, received, 2)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		commits, _ := reader.committed()
+		if len(commits) > 0 {
+			if fmt.Sprint(commits) != "[[0 1]]" {
+				t.Fatalf("unexpected commits %v", commits)
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the broadcast messages are not committed after the interval")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
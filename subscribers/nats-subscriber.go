@@ -0,0 +1,168 @@
+package subscribers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/larisgo/laravel-echo-server/options"
+	"github.com/larisgo/laravel-echo-server/types"
+	"github.com/nats-io/nats.go"
+	"github.com/zishang520/engine.io/utils"
+)
+
+type NatsSubscriber struct {
+
+	// Reports the state of the connection.
+	*reporter
+
+	// NATS connection, reconnecting on its own.
+	conn *nats.Conn
+
+	// Configurable server options.
+	options *options.Config
+
+	// Stripped from the subjects to get the channel names.
+	prefix string
+
+	// Closed once the connection is closed.
+	closed chan struct{}
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// Create a new instance of subscriber.
+func NewNatsSubscriber(_options *options.Config) (Subscriber, error) {
+	sub := &NatsSubscriber{}
+	sub.reporter = newReporter("nats")
+	sub.ctx, sub.cancel = context.WithCancel(context.Background())
+	sub.options = _options
+	sub.prefix = subjectPrefix(_options.SubscriberConfig.Nats.Subject)
+	sub.closed = make(chan struct{})
+
+	conn, err := nats.Connect(_options.SubscriberConfig.Nats.Url,
+		nats.Name("laravel-echo-server"),
+		nats.MaxReconnects(-1),
+		nats.CustomReconnectDelay(reconnectBackoff),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			if sub.ctx.Err() == nil {
+				sub.report(StateReconnecting, err)
+			}
+		}),
+		nats.ReconnectHandler(func(*nats.Conn) {
+			sub.report(StateConnected, nil)
+		}),
+		nats.ClosedHandler(func(*nats.Conn) {
+			close(sub.closed)
+		}),
+	)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("NATS connection failed: %v", err))
+	}
+	sub.conn = conn
+	return sub, nil
+}
+
+// Every server node subscribes to the subject, unless they share a durable JetStream consumer.
+func (sub *NatsSubscriber) FansOut() bool {
+	return sub.options.SubscriberConfig.Nats.Durable == ""
+}
+
+// Subscribe to events to broadcast, the connection subscribes again after a reconnection.
+func (sub *NatsSubscriber) Subscribe(callback Broadcast) {
+	go func() {
+		defer sub.stop()
+
+		sub.report(StateConnecting, nil)
+		for attempt := 0; sub.ctx.Err() == nil; attempt++ {
+			err := sub.subscribe(callback)
+			if err == nil {
+				sub.report(StateConnected, nil)
+				break
+			}
+			sub.report(StateReconnecting, err)
+			select {
+			case <-time.After(reconnectBackoff(attempt)):
+			case <-sub.ctx.Done():
+			}
+		}
+
+		// The connection reports no more once closed.
+		<-sub.closed
+	}()
+}
+
+// Subscribe to the subject, through a durable JetStream consumer if configured.
+func (sub *NatsSubscriber) subscribe(callback Broadcast) error {
+	config := sub.options.SubscriberConfig.Nats
+	handler := func(msg *nats.Msg) {
+		sub.broadcast(msg, callback)
+	}
+	if config.Durable == "" {
+		_, err := sub.conn.Subscribe(config.Subject, handler)
+		return err
+	}
+
+	js, err := sub.conn.JetStream()
+	if err != nil {
+		return err
+	}
+	// A new consumer starts with the messages published from now on.
+	_, err = js.Subscribe(config.Subject, handler, nats.Durable(config.Durable), nats.ManualAck(), nats.DeliverNew())
+	return err
+}
+
+// Broadcast a message on the channel of its subject, malformed messages are skipped.
+func (sub *NatsSubscriber) broadcast(msg *nats.Msg, callback Broadcast) {
+	var message *types.Data
+	if err := json.Unmarshal(msg.Data, &message); err != nil || message == nil {
+		utils.Log().Error("Skipped malformed nats message on %s: %v", msg.Subject, err)
+		sub.ack(msg, false)
+		return
+	}
+	channel := strings.TrimPrefix(msg.Subject, sub.prefix)
+	if sub.options.DevMode {
+		utils.Log().Info("Channel: " + channel)
+		utils.Log().Info("Event: " + message.Event)
+	}
+	callback(channel, message)
+	sub.ack(msg, true)
+}
+
+// Acknowledge a JetStream message, a malformed one is never redelivered.
+func (sub *NatsSubscriber) ack(msg *nats.Msg, broadcast bool) {
+	if sub.options.SubscriberConfig.Nats.Durable == "" {
+		return
+	}
+	if broadcast {
+		msg.Ack()
+	} else {
+		msg.Term()
+	}
+}
+
+// Unsubscribe from events to broadcast, once the messages being handled are broadcast.
+func (sub *NatsSubscriber) UnSubscribe() {
+	sub.cancel()
+	if err := sub.conn.Drain(); err != nil {
+		sub.conn.Close()
+	}
+}
+
+// Get the literal tokens a subject starts with, up to its first wildcard.
+func subjectPrefix(subject string) string {
+	tokens := strings.Split(subject, ".")
+	for i, token := range tokens {
+		if token == "*" || token == ">" {
+			if i == 0 {
+				return ""
+			}
+			return strings.Join(tokens[:i], ".") + "."
+		}
+	}
+	return ""
+}
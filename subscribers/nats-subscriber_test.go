@@ -0,0 +1,125 @@
+package subscribers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/larisgo/laravel-echo-server/options"
+	"github.com/larisgo/laravel-echo-server/types"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+)
+
+// Start an embedded NATS server with JetStream.
+func runNatsServer(t *testing.T) *server.Server {
+	t.Helper()
+	ns, err := server.NewServer(&server.Options{Host: "127.0.0.1", Port: -1, JetStream: true, StoreDir: t.TempDir(), NoLog: true, NoSigs: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go ns.Start()
+	if !ns.ReadyForConnections(5 * time.Second) {
+		t.Fatal("the NATS server did not start")
+	}
+	t.Cleanup(ns.Shutdown)
+	return ns
+}
+
+// Subscribe to the NATS server and return the broadcast events and a publishing connection.
+func subscribeNats(t *testing.T, config options.Nats) (chan broadcastEvent, *nats.Conn) {
+	t.Helper()
+	_options := &options.Config{}
+	_options.SubscriberConfig.Nats = config
+	sub, err := NewNatsSubscriber(_options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(sub.UnSubscribe)
+
+	events := make(chan broadcastEvent, 10)
+	sub.Subscribe(func(channel string, data *types.Data) {
+		events <- broadcastEvent{channel, data}
+	})
+	waitConnected(t, sub.(StatusReporter))
+
+	conn, err := nats.Connect(config.Url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(conn.Close)
+	return events, conn
+}
+
+func TestNatsSubscriber(t *testing.T) {
+	ns := runNatsServer(t)
+	events, conn := subscribeNats(t, options.Nats{Url: ns.ClientURL(), Subject: "echo.>"})
+
+	conn.Publish("echo.private-orders", []byte(`{"event":"OrderShipped","data":{"id":1}}`))
+	conn.Publish("echo.orders", []byte(`{invalid`))
+	conn.Publish("echo.orders", []byte(`{"event":"Updated","data":{}}`))
+	conn.Flush()
+
+	if event := receive(t, events); event.channel != "private-orders" || event.data.Event != "OrderShipped" {
+		t.Fatalf("unexpected event %+v", event)
+	}
+	if event := receive(t, events); event.channel != "orders" || event.data.Event != "Updated" {
+		t.Fatalf("the malformed message is not skipped, got %+v", event)
+	}
+}
+
+func TestNatsSubscriberJetStream(t *testing.T) {
+	ns := runNatsServer(t)
+	conn, err := nats.Connect(ns.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	js, err := conn.JetStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := js.AddStream(&nats.StreamConfig{Name: "ECHO", Subjects: []string{"echo.>"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	events, _ := subscribeNats(t, options.Nats{Url: ns.ClientURL(), Subject: "echo.>", Durable: "echo"})
+	if _, err := js.Publish("echo.orders", []byte(`{invalid`)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := js.Publish("echo.orders", []byte(`{"event":"OrderShipped","data":{}}`)); err != nil {
+		t.Fatal(err)
+	}
+	if event := receive(t, events); event.channel != "orders" || event.data.Event != "OrderShipped" {
+		t.Fatalf("unexpected event %+v", event)
+	}
+
+	// Every message is acknowledged, the malformed one included.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		info, err := js.ConsumerInfo("ECHO", "echo")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.NumAckPending == 0 && info.NumPending == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("messages are left unacknowledged: %+v", info)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestSubjectPrefix(t *testing.T) {
+	for subject, prefix := range map[string]string{
+		"echo.>":        "echo.",
+		"app.echo.*":    "app.echo.",
+		"echo.*.events": "echo.",
+		">":             "",
+		"echo":          "",
+	} {
+		if result := subjectPrefix(subject); result != prefix {
+			t.Errorf("%s: expected %q, got %q", subject, prefix, result)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package subscribers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/larisgo/laravel-echo-server/options"
+	"github.com/larisgo/laravel-echo-server/types"
+	"github.com/lib/pq"
+	"github.com/zishang520/engine.io/utils"
+)
+
+// How long the connection may stay quiet before it is checked.
+const postgresPingInterval = 90 * time.Second
+
+type PostgresSubscriber struct {
+
+	// Reports the state of the connection.
+	*reporter
+
+	// Listener of the notifications, reconnecting on its own.
+	listener *pq.Listener
+
+	// Connection pool loading the payloads too large for a notification.
+	db *sql.DB
+
+	// Configurable server options.
+	options *options.Config
+
+	// Query taking a payload by id out of the table.
+	payloadQuery string
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// Create a new instance of subscriber.
+func NewPostgresSubscriber(_options *options.Config) (Subscriber, error) {
+	sub := &PostgresSubscriber{}
+	sub.reporter = newReporter("postgres")
+	sub.ctx, sub.cancel = context.WithCancel(context.Background())
+	sub.options = _options
+
+	config := _options.SubscriberConfig.Postgres
+	if len(config.Channels) == 0 {
+		return nil, errors.New("The postgres subscriber needs channels to listen on.")
+	}
+	db, err := sql.Open("postgres", config.Dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.PingContext(sub.ctx); err != nil {
+		db.Close()
+		return nil, errors.New(fmt.Sprintf("Postgres connection failed: %v", err))
+	}
+	sub.db = db
+	sub.payloadQuery = "DELETE FROM " + pq.QuoteIdentifier(config.PayloadTable) + " WHERE id = $1 RETURNING payload"
+
+	sub.report(StateConnecting, nil)
+	sub.listener = pq.NewListener(config.Dsn, reconnectDelay, maxReconnectDelay, sub.onEvent)
+	return sub, nil
+}
+
+// Report the state changes of the listener connection.
+func (sub *PostgresSubscriber) onEvent(event pq.ListenerEventType, err error) {
+	switch event {
+	case pq.ListenerEventConnected, pq.ListenerEventReconnected:
+		sub.report(StateConnected, nil)
+	case pq.ListenerEventDisconnected, pq.ListenerEventConnectionAttemptFailed:
+		sub.report(StateReconnecting, err)
+	}
+}
+
+// Every server node listens on the channels.
+func (sub *PostgresSubscriber) FansOut() bool {
+	return true
+}
+
+// Subscribe to events to broadcast.
+func (sub *PostgresSubscriber) Subscribe(callback Broadcast) {
+	sub.SubscribeRelayed(callback, callback)
+}
+
+// Subscribe to events to broadcast, the listener listens again on the channels
+// after a reconnection. The payloads of the table are taken by a single node, which
+// broadcasts them with the relayed callback.
+func (sub *PostgresSubscriber) SubscribeRelayed(callback Broadcast, relayed Broadcast) {
+	go func() {
+		// The notifications are closed once the listener is closed and reports no more.
+		defer sub.stop()
+
+		for _, channel := range sub.options.SubscriberConfig.Postgres.Channels {
+			if err := sub.listener.Listen(channel); err != nil && sub.ctx.Err() == nil {
+				utils.Log().Error("Unable to listen on the postgres channel %s: %v", channel, err)
+			}
+		}
+
+		for {
+			select {
+			case notification, ok := <-sub.listener.Notify:
+				if !ok {
+					return
+				}
+				// A nil notification follows a reconnection.
+				if notification != nil {
+					sub.broadcast(notification, callback, relayed)
+				}
+			case <-time.After(postgresPingInterval):
+				go sub.listener.Ping()
+			}
+		}
+	}()
+}
+
+// Broadcast a notification, its payload is the event or the id of the event
+// in the payload table. Malformed notifications are skipped.
+func (sub *PostgresSubscriber) broadcast(notification *pq.Notification, callback Broadcast, relayed Broadcast) {
+	payload := []byte(notification.Extra)
+
+	var reference *PostgresPayloadReference
+	if err := json.Unmarshal(payload, &reference); err == nil && reference != nil && reference.PayloadId != nil {
+		id, err := strconv.ParseInt(strings.Trim(string(reference.PayloadId), `"`), 10, 64)
+		if err != nil {
+			utils.Log().Error("Skipped postgres notification on %s with the invalid payload_id %s", notification.Channel, reference.PayloadId)
+			return
+		}
+		// The first node to take the row broadcasts it to the cluster.
+		if err := sub.db.QueryRowContext(sub.ctx, sub.payloadQuery, id).Scan(&payload); err != nil {
+			if err == sql.ErrNoRows {
+				if sub.options.DevMode {
+					utils.Log().Info("The postgres payload %d was taken by another node", id)
+				}
+				return
+			}
+			utils.Log().Error("Unable to load the postgres payload %d: %v", id, err)
+			return
+		}
+		callback = relayed
+	}
+
+	var message *types.Data
+	if err := json.Unmarshal(payload, &message); err != nil || message == nil {
+		utils.Log().Error("Skipped malformed postgres notification on %s: %v", notification.Channel, err)
+		return
+	}
+	channel := message.Channel
+	if channel == "" {
+		channel = notification.Channel
+	}
+	if sub.options.DevMode {
+		utils.Log().Info("Channel: " + channel)
+		utils.Log().Info("Event: " + message.Event)
+	}
+	callback(channel, message)
+}
+
+// Unsubscribe from events to broadcast.
+func (sub *PostgresSubscriber) UnSubscribe() {
+	sub.cancel()
+	sub.listener.Close()
+	sub.db.Close()
+}
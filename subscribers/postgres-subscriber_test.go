@@ -0,0 +1,144 @@
+package subscribers
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/larisgo/laravel-echo-server/options"
+	"github.com/larisgo/laravel-echo-server/types"
+	"github.com/lib/pq"
+)
+
+// The tests run against the database of ECHO_TEST_POSTGRES_DSN, like
+// "postgres://postgres@localhost/postgres?sslmode=disable", and are skipped without it.
+func postgresTestDsn(t *testing.T) string {
+	t.Helper()
+	dsn := os.Getenv("ECHO_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("ECHO_TEST_POSTGRES_DSN is not set")
+	}
+	return dsn
+}
+
+// Wait for a broadcast event.
+func receive(t *testing.T, events chan broadcastEvent) broadcastEvent {
+	t.Helper()
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event was broadcast")
+	}
+	return broadcastEvent{}
+}
+
+// Wait for a subscriber to report its connection.
+func waitConnected(t *testing.T, sub StatusReporter) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case status := <-sub.Status():
+			if status.State == StateConnected {
+				return
+			}
+		case <-timeout:
+			t.Fatal("the subscriber did not connect")
+		}
+	}
+}
+
+func TestPostgresSubscriberNeedsChannels(t *testing.T) {
+	if _, err := NewPostgresSubscriber(&options.Config{}); err == nil {
+		t.Fatal("a subscriber without channels is created")
+	}
+}
+
+func TestPostgresInvalidPayloadId(t *testing.T) {
+	sub := &PostgresSubscriber{options: &options.Config{}}
+	for _, payload := range []string{`{"payload_id":"abc"}`, `{"payload_id":1.5}`, `{"payload_id":{}}`, `{"payload_id":null}`} {
+		sub.broadcast(&pq.Notification{Channel: "echo", Extra: payload}, func(channel string, data *types.Data) {
+			t.Errorf("%s is broadcast", payload)
+		}, func(channel string, data *types.Data) {
+			t.Errorf("%s is relayed", payload)
+		})
+	}
+}
+
+func TestPostgresSubscriber(t *testing.T) {
+	dsn := postgresTestDsn(t)
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	suffix := time.Now().UnixNano()
+	channel := fmt.Sprintf("echo_test_%d", suffix)
+	table := fmt.Sprintf("echo_test_payloads_%d", suffix)
+	if _, err := db.Exec("CREATE TABLE " + table + " (id BIGINT PRIMARY KEY, payload TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Exec("DROP TABLE " + table)
+
+	_options := &options.Config{}
+	_options.SubscriberConfig.Postgres = options.Postgres{Dsn: dsn, Channels: []string{channel}, PayloadTable: table}
+	sub, err := NewPostgresSubscriber(_options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.UnSubscribe()
+
+	events := make(chan broadcastEvent, 10)
+	sub.Subscribe(func(channel string, data *types.Data) {
+		events <- broadcastEvent{channel, data}
+	})
+	// Wait for the listener, a notification sent before it listens is lost.
+	waitConnected(t, sub.(StatusReporter))
+	time.Sleep(500 * time.Millisecond)
+
+	notify := func(payload string) {
+		if _, err := db.Exec("SELECT pg_notify($1, $2)", channel, payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	notify(`{"channel":"orders","event":"OrderShipped","data":{"id":1}}`)
+	if event := receive(t, events); event.channel != "orders" || event.data.Event != "OrderShipped" {
+		t.Fatalf("unexpected event %+v", event)
+	}
+
+	// Malformed notifications are skipped, the channel of the notification is the default.
+	notify(`{invalid`)
+	notify(`{"event":"Updated","data":{}}`)
+	if event := receive(t, events); event.channel != channel || event.data.Event != "Updated" {
+		t.Fatalf("unexpected event %+v", event)
+	}
+
+	// Payloads too large for a notification are loaded from the table.
+	if _, err := db.Exec("INSERT INTO "+table+" (id, payload) VALUES (1, $1)", `{"channel":"orders","event":"Large","data":{}}`); err != nil {
+		t.Fatal(err)
+	}
+	notify(`{"payload_id":1}`)
+	if event := receive(t, events); event.channel != "orders" || event.data.Event != "Large" {
+		t.Fatalf("unexpected event %+v", event)
+	}
+	var rows int
+	if err := db.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&rows); err != nil || rows != 0 {
+		t.Fatalf("the payload row is kept: %d rows (%v)", rows, err)
+	}
+
+	// Invalid and taken payload ids broadcast nothing.
+	notify(`{"payload_id":"abc"}`)
+	notify(`{"payload_id":1}`)
+	if _, err := db.Exec("INSERT INTO "+table+" (id, payload) VALUES (2, $1)", `{"channel":"orders","event":"Next","data":{}}`); err != nil {
+		t.Fatal(err)
+	}
+	notify(`{"payload_id":"2"}`)
+	if event := receive(t, events); event.data.Event != "Next" {
+		t.Fatalf("unexpected event %+v", event)
+	}
+}
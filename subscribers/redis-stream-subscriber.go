@@ -0,0 +1,296 @@
+package subscribers
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/larisgo/laravel-echo-server/database"
+	"github.com/larisgo/laravel-echo-server/options"
+	"github.com/larisgo/laravel-echo-server/types"
+	"github.com/zishang520/engine.io/utils"
+)
+
+// How long a read waits for new entries.
+const streamBlock = 5 * time.Second
+
+// How often the entries left pending by other consumers are claimed.
+const claimInterval = 30 * time.Second
+
+type RedisStreamSubscriber struct {
+
+	// Reports the state of the connection.
+	*reporter
+
+	// Redis client.
+	redis redis.UniversalClient
+
+	// Configurable server options.
+	options *options.Config
+
+	// Key of the stream.
+	stream string
+
+	// Consumer group and name of this server.
+	group    string
+	consumer string
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// Create a new instance of subscriber.
+func NewRedisStreamSubscriber(_options *options.Config) (Subscriber, error) {
+	sub := &RedisStreamSubscriber{}
+	sub.reporter = newReporter("redis stream")
+	sub.ctx, sub.cancel = context.WithCancel(context.Background())
+	sub.options = _options
+	sub.stream = _options.DatabaseConfig.Redis.KeyPrefix + _options.SubscriberConfig.RedisStream.Stream
+	sub.group = _options.SubscriberConfig.RedisStream.Group
+	sub.consumer = _options.SubscriberConfig.RedisStream.Consumer
+	// Without the redis adapter to relay the broadcasts to the other nodes, every
+	// node reads every entry with a group of its own, named after its stable consumer
+	// name so it resumes where it left off after a restart.
+	if _options.Cluster.Adapter != "redis" && sub.consumer != "" {
+		sub.group += ":" + sub.consumer
+	}
+	if sub.consumer == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, err
+		}
+		sub.consumer = hostname
+	}
+	client, err := database.NewRedisClient(_options)
+	if err != nil {
+		return nil, err
+	}
+	sub.redis = client
+	return sub, nil
+}
+
+// Subscribe to events to broadcast, reconnecting until unsubscribed.
+func (sub *RedisStreamSubscriber) Subscribe(callback Broadcast) {
+	go func() {
+		defer sub.stop()
+
+		sub.report(StateConnecting, nil)
+		for attempt := 0; ; attempt++ {
+			err := sub.createGroup()
+			if err == nil {
+				attempt = 0
+				sub.report(StateConnected, nil)
+				err = sub.receive(callback)
+			}
+			if sub.ctx.Err() != nil {
+				return
+			}
+			sub.report(StateReconnecting, err)
+			select {
+			case <-time.After(reconnectBackoff(attempt)):
+			case <-sub.ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Create the consumer group, reading the entries added from now on.
+func (sub *RedisStreamSubscriber) createGroup() error {
+	err := sub.redis.XGroupCreateMkStream(sub.ctx, sub.stream, sub.group, "$").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+	return nil
+}
+
+// Broadcast the entries of the stream until the connection fails. The entries
+// delivered to this consumer before a restart and never acknowledged come first.
+func (sub *RedisStreamSubscriber) receive(callback Broadcast) error {
+	cursor := "0"
+	claimed := time.Now()
+	for {
+		if cursor == ">" && time.Since(claimed) >= claimInterval {
+			if err := sub.claim(callback); err != nil {
+				return err
+			}
+			claimed = time.Now()
+		}
+
+		streams, err := sub.redis.XReadGroup(sub.ctx, &redis.XReadGroupArgs{
+			Group:    sub.group,
+			Consumer: sub.consumer,
+			Streams:  []string{sub.stream, cursor},
+			Count:    sub.options.SubscriberConfig.RedisStream.BatchSize,
+			Block:    streamBlock,
+		}).Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		messages := []redis.XMessage{}
+		for _, stream := range streams {
+			messages = append(messages, stream.Messages...)
+		}
+		if cursor != ">" {
+			if len(messages) == 0 {
+				cursor = ">"
+				continue
+			}
+			cursor = messages[len(messages)-1].ID
+		}
+
+		if err := sub.handle(messages, callback); err != nil {
+			return err
+		}
+	}
+}
+
+// Broadcast and acknowledge a batch of entries, then trim the entries every group is done with.
+func (sub *RedisStreamSubscriber) handle(messages []redis.XMessage, callback Broadcast) error {
+	ids := make([]string, 0, len(messages))
+	for _, message := range messages {
+		sub.broadcast(message, callback)
+		ids = append(ids, message.ID)
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	if err := sub.redis.XAck(sub.ctx, sub.stream, sub.group, ids...).Err(); err != nil {
+		return err
+	}
+	if maxLen := sub.options.SubscriberConfig.RedisStream.MaxLen; maxLen > 0 {
+		return sub.trim(maxLen)
+	}
+	return nil
+}
+
+// Once the stream is longer than the given length, trim the entries that every group, the
+// groups of the other nodes included, has read and acknowledged.
+func (sub *RedisStreamSubscriber) trim(maxLen int64) error {
+	length, err := sub.redis.XLen(sub.ctx, sub.stream).Result()
+	if err != nil || length <= maxLen {
+		return err
+	}
+	minId, err := sub.trimId()
+	if err != nil || minId == "" {
+		return err
+	}
+	return sub.redis.XTrimMinIDApprox(sub.ctx, sub.stream, minId, 0).Err()
+}
+
+// Get the id of the oldest entry some group has not read or acknowledged yet, or of the
+// last entry read if all of them are done with it.
+func (sub *RedisStreamSubscriber) trimId() (string, error) {
+	groups, err := sub.redis.XInfoGroups(sub.ctx, sub.stream).Result()
+	if err != nil {
+		return "", err
+	}
+	minId := ""
+	for _, group := range groups {
+		// The entries after the last delivered one are unread, the pending ones unacknowledged.
+		id := group.LastDeliveredID
+		if group.Pending > 0 {
+			pending, err := sub.redis.XPending(sub.ctx, sub.stream, group.Name).Result()
+			if err != nil {
+				return "", err
+			}
+			if pending.Lower != "" {
+				id = pending.Lower
+			}
+		}
+		if minId == "" || compareStreamIds(id, minId) < 0 {
+			minId = id
+		}
+	}
+	return minId, nil
+}
+
+// Compare two stream entry ids, "<milliseconds>-<sequence>".
+func compareStreamIds(a string, b string) int {
+	aTime, aSeq, _ := strings.Cut(a, "-")
+	bTime, bSeq, _ := strings.Cut(b, "-")
+	for _, parts := range [][2]string{{aTime, bTime}, {aSeq, bSeq}} {
+		x, _ := strconv.ParseUint(parts[0], 10, 64)
+		y, _ := strconv.ParseUint(parts[1], 10, 64)
+		if x < y {
+			return -1
+		}
+		if x > y {
+			return 1
+		}
+	}
+	return 0
+}
+
+// Take over the entries that other consumers, like a node that is gone, left
+// pending for longer than the claim idle time, and broadcast them.
+func (sub *RedisStreamSubscriber) claim(callback Broadcast) error {
+	idle := time.Duration(sub.options.SubscriberConfig.RedisStream.ClaimIdle) * time.Millisecond
+	if idle <= 0 {
+		return nil
+	}
+	pending, err := sub.redis.XPendingExt(sub.ctx, &redis.XPendingExtArgs{
+		Stream: sub.stream,
+		Group:  sub.group,
+		Start:  "-",
+		End:    "+",
+		Count:  sub.options.SubscriberConfig.RedisStream.BatchSize,
+	}).Result()
+	if err != nil {
+		return err
+	}
+	ids := []string{}
+	for _, entry := range pending {
+		if entry.Consumer != sub.consumer && entry.Idle >= idle {
+			ids = append(ids, entry.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	messages, err := sub.redis.XClaim(sub.ctx, &redis.XClaimArgs{
+		Stream:   sub.stream,
+		Group:    sub.group,
+		Consumer: sub.consumer,
+		MinIdle:  idle,
+		Messages: ids,
+	}).Result()
+	if err != nil {
+		return err
+	}
+	if sub.options.DevMode && len(messages) > 0 {
+		utils.Log().Info("Claimed %d pending redis stream entries", len(messages))
+	}
+	return sub.handle(messages, callback)
+}
+
+// Broadcast an entry with the "channel" and "payload" fields, malformed entries are skipped.
+func (sub *RedisStreamSubscriber) broadcast(entry redis.XMessage, callback Broadcast) {
+	channel, _ := entry.Values["channel"].(string)
+	payload, _ := entry.Values["payload"].(string)
+
+	var message *types.Data
+	if err := json.Unmarshal([]byte(payload), &message); err != nil || message == nil || channel == "" {
+		utils.Log().Error("Skipped malformed redis stream entry %s: %v", entry.ID, err)
+		return
+	}
+	if sub.options.DevMode {
+		utils.Log().Info("Channel: " + channel)
+		utils.Log().Info("Event: " + message.Event)
+	}
+	callback(channel, message)
+}
+
+// Unsubscribe from events to broadcast.
+func (sub *RedisStreamSubscriber) UnSubscribe() {
+	sub.cancel()
+	database.ReleaseRedisClient()
+}
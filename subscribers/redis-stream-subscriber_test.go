@@ -0,0 +1,141 @@
+package subscribers
+
+import (
+	"context"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/larisgo/laravel-echo-server/options"
+)
+
+// The tests run against the Redis server of ECHO_TEST_REDIS_ADDR, like "localhost:6379",
+// and are skipped without it.
+func redisTestOptions(t *testing.T) *options.Config {
+	t.Helper()
+	addr := os.Getenv("ECHO_TEST_REDIS_ADDR")
+	if addr == "" {
+		t.Skip("ECHO_TEST_REDIS_ADDR is not set")
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_options := &options.Config{}
+	_options.DatabaseConfig.Redis.Host, _options.DatabaseConfig.Redis.Port = host, port
+	_options.DatabaseConfig.Redis.KeyPrefix = "echo-test:"
+	_options.SubscriberConfig.RedisStream = options.RedisStream{Stream: t.Name(), Group: "echo", BatchSize: 100}
+	return _options
+}
+
+func TestCompareStreamIds(t *testing.T) {
+	for _, test := range []struct {
+		a, b   string
+		result int
+	}{
+		{"1-0", "1-0", 0},
+		{"1-0", "1-1", -1},
+		{"2-0", "1-9", 1},
+		{"9-0", "10-0", -1},
+		{"0-0", "1526919030474-55", -1},
+	} {
+		if result := compareStreamIds(test.a, test.b); result != test.result {
+			t.Errorf("%s compared to %s: %d, expected %d", test.a, test.b, result, test.result)
+		}
+	}
+}
+
+func TestRedisStreamGroups(t *testing.T) {
+	_options := redisTestOptions(t)
+
+	_options.SubscriberConfig.RedisStream.Consumer = "node-1"
+	sub, err := NewRedisStreamSubscriber(_options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.UnSubscribe()
+	if group := sub.(*RedisStreamSubscriber).group; group != "echo:node-1" {
+		t.Errorf("without the redis adapter the group is %q", group)
+	}
+
+	_options.Cluster.Adapter = "redis"
+	shared, err := NewRedisStreamSubscriber(_options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer shared.UnSubscribe()
+	if group := shared.(*RedisStreamSubscriber).group; group != "echo" {
+		t.Errorf("with the redis adapter the group is %q", group)
+	}
+
+	_options.Cluster.Adapter, _options.SubscriberConfig.RedisStream.Consumer = "", ""
+	single, err := NewRedisStreamSubscriber(_options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer single.UnSubscribe()
+	if group := single.(*RedisStreamSubscriber).group; group != "echo" {
+		t.Errorf("without a consumer name the group is %q", group)
+	}
+}
+
+func TestRedisStreamTrimKeepsUnread(t *testing.T) {
+	_options := redisTestOptions(t)
+	sub, err := NewRedisStreamSubscriber(_options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.UnSubscribe()
+	stream := sub.(*RedisStreamSubscriber)
+	ctx := context.Background()
+	stream.redis.Del(ctx, stream.stream)
+	defer stream.redis.Del(ctx, stream.stream)
+
+	ids := []string{}
+	for i := 0; i < 10; i++ {
+		id, err := stream.redis.XAdd(ctx, &redis.XAddArgs{Stream: stream.stream, Values: map[string]any{"channel": "orders", "payload": "{}"}}).Result()
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	read := func(group string, count int64, ack int) {
+		t.Helper()
+		if err := stream.redis.XGroupCreate(ctx, stream.stream, group, "0").Err(); err != nil {
+			t.Fatal(err)
+		}
+		if count == 0 {
+			return
+		}
+		streams, err := stream.redis.XReadGroup(ctx, &redis.XReadGroupArgs{Group: group, Consumer: "c", Streams: []string{stream.stream, ">"}, Count: count}).Result()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, message := range streams[0].Messages[:ack] {
+			stream.redis.XAck(ctx, stream.stream, group, message.ID)
+		}
+	}
+
+	// Every entry read and acknowledged.
+	read("done", 10, 10)
+	if id, err := stream.trimId(); err != nil || id != ids[9] {
+		t.Fatalf("expected to trim up to %s, got %s (%v)", ids[9], id, err)
+	}
+	// Six entries read, the fourth not acknowledged.
+	read("pending", 6, 3)
+	if id, err := stream.trimId(); err != nil || id != ids[3] {
+		t.Fatalf("expected to trim up to %s, got %s (%v)", ids[3], id, err)
+	}
+	// Nothing read.
+	read("idle", 0, 0)
+	if id, err := stream.trimId(); err != nil || id != "0-0" {
+		t.Fatalf("expected to trim nothing, got %s (%v)", id, err)
+	}
+	if err := stream.trim(1); err != nil {
+		t.Fatal(err)
+	}
+	if length := stream.redis.XLen(ctx, stream.stream).Val(); length != 10 {
+		t.Fatalf("the unread entries were trimmed, %d left", length)
+	}
+}
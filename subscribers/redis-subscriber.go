@@ -3,11 +3,13 @@ package subscribers
 import (
 	"context"
 	"encoding/json"
-	"errors"
-	"fmt"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/go-redis/redis/v8"
+	"github.com/larisgo/laravel-echo-server/adapters"
+	"github.com/larisgo/laravel-echo-server/database"
 	"github.com/larisgo/laravel-echo-server/options"
 	"github.com/larisgo/laravel-echo-server/types"
 	"github.com/zishang520/engine.io/utils"
@@ -15,8 +17,15 @@ import (
 
 type RedisSubscriber struct {
 
+	// Reports the state of the connection.
+	*reporter
+
 	// Redis client.
-	redis *redis.Client
+	redis redis.UniversalClient
+
+	// The current subscription, closed to unsubscribe.
+	pubsub *redis.PubSub
+	mu     sync.Mutex
 
 	// Configurable server options.
 	options *options.Config
@@ -31,61 +40,104 @@ type RedisSubscriber struct {
 // Create a new instance of subscriber.
 func NewRedisSubscriber(_options *options.Config) (Subscriber, error) {
 	sub := &RedisSubscriber{}
+	sub.reporter = newReporter("redis")
 	sub.ctx, sub.cancel = context.WithCancel(context.Background())
 	sub.keyPrefix = _options.DatabaseConfig.Redis.KeyPrefix
-	sub.redis = redis.NewClient(&redis.Options{
-		Addr:     _options.DatabaseConfig.Redis.Host + ":" + _options.DatabaseConfig.Redis.Port,
-		Username: _options.DatabaseConfig.Redis.Username,
-		Password: _options.DatabaseConfig.Redis.Password,
-		DB:       _options.DatabaseConfig.Redis.Db,
-	})
-	if _, err := sub.redis.Ping(sub.ctx).Result(); err != nil {
-		return nil, errors.New(fmt.Sprintf("redis connection failed: %v", err))
+	client, err := database.NewRedisClient(_options)
+	if err != nil {
+		return nil, err
 	}
+	sub.redis = client
 	sub.options = _options
 	return sub, nil
 }
 
-// Subscribe to events to broadcast.
+// Every server node subscribes to the channels.
+func (sub *RedisSubscriber) FansOut() bool {
+	return true
+}
+
+// Subscribe to events to broadcast, reconnecting until unsubscribed.
 func (sub *RedisSubscriber) Subscribe(callback Broadcast) {
-	pubsub := sub.redis.PSubscribe(sub.ctx, sub.keyPrefix+"*")
-	utils.Log().Success("Listening for redis events...")
 	go func() {
-		defer pubsub.Close()
-	LOOP:
-		for {
+		defer sub.stop()
+
+		sub.report(StateConnecting, nil)
+		for attempt := 0; ; attempt++ {
+			pubsub, err := sub.psubscribe()
+			if err == nil {
+				attempt = 0
+				sub.report(StateConnected, nil)
+				err = sub.receive(pubsub, callback)
+				pubsub.Close()
+			}
+			if sub.ctx.Err() != nil {
+				return
+			}
+			sub.report(StateReconnecting, err)
 			select {
+			case <-time.After(reconnectBackoff(attempt)):
 			case <-sub.ctx.Done():
-				break LOOP
-			default:
-				// ReceiveTimeout is a low level API. Use ReceiveMessage instead.
-				msg, err := pubsub.ReceiveMessage(sub.ctx)
-				if err != nil {
-					if sub.options.DevMode {
-						utils.Log().Error("%v", err)
-					}
-					break LOOP
-				}
-				var message *types.Data
-				if err := json.Unmarshal([]byte(msg.Payload), &message); err != nil {
-					if sub.options.DevMode {
-						utils.Log().Error("%v", err)
-					}
-					break LOOP
-				}
-				channel := strings.TrimPrefix(msg.Channel, sub.keyPrefix)
-				if sub.options.DevMode {
-					utils.Log().Info("Channel: " + channel)
-					utils.Log().Info("Event: " + message.Event)
-				}
-				callback(channel, message)
+				return
 			}
 		}
 	}()
 }
 
+// Subscribe to the channels and wait for the confirmation.
+func (sub *RedisSubscriber) psubscribe() (*redis.PubSub, error) {
+	pubsub := sub.redis.PSubscribe(sub.ctx, sub.keyPrefix+"*")
+	if _, err := pubsub.Receive(sub.ctx); err != nil {
+		pubsub.Close()
+		return nil, err
+	}
+
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+
+	// Unsubscribed while subscribing.
+	if sub.ctx.Err() != nil {
+		pubsub.Close()
+		return nil, sub.ctx.Err()
+	}
+	sub.pubsub = pubsub
+	return pubsub, nil
+}
+
+// Broadcast the received events until the connection fails.
+func (sub *RedisSubscriber) receive(pubsub *redis.PubSub, callback Broadcast) error {
+	for {
+		// ReceiveTimeout is a low level API. Use ReceiveMessage instead.
+		msg, err := pubsub.ReceiveMessage(sub.ctx)
+		if err != nil {
+			return err
+		}
+		// Messages of the cluster nodes are not broadcasts.
+		if strings.HasPrefix(msg.Channel, adapters.RedisChannelPrefix) {
+			continue
+		}
+		var message *types.Data
+		if err := json.Unmarshal([]byte(msg.Payload), &message); err != nil || message == nil {
+			utils.Log().Error("Skipped malformed redis message on %s: %v", msg.Channel, err)
+			continue
+		}
+		channel := strings.TrimPrefix(msg.Channel, sub.keyPrefix)
+		if sub.options.DevMode {
+			utils.Log().Info("Channel: " + channel)
+			utils.Log().Info("Event: " + message.Event)
+		}
+		callback(channel, message)
+	}
+}
+
 // Unsubscribe from events to broadcast.
 func (sub *RedisSubscriber) UnSubscribe() {
+	sub.mu.Lock()
 	sub.cancel()
-	sub.redis.Close()
+	if sub.pubsub != nil {
+		sub.pubsub.Close()
+	}
+	sub.mu.Unlock()
+
+	database.ReleaseRedisClient()
 }
@@ -0,0 +1,180 @@
+package subscribers
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/larisgo/laravel-echo-server/options"
+	"github.com/larisgo/laravel-echo-server/types"
+)
+
+// A Redis server answering the pattern subscriptions, each subscribed connection is
+// handed over to publish to it or to drop it.
+type fakeRedis struct {
+	listener net.Listener
+	conns    chan net.Conn
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &fakeRedis{listener: listener, conns: make(chan net.Conn, 10)}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go r.serve(conn)
+		}
+	}()
+	return r
+}
+
+func (r *fakeRedis) serve(conn net.Conn) {
+	reader := bufio.NewReader(conn)
+	for {
+		command, err := readCommand(reader)
+		if err != nil {
+			conn.Close()
+			return
+		}
+		switch strings.ToLower(command[0]) {
+		case "psubscribe":
+			r.conns <- conn
+			fmt.Fprintf(conn, "*3\r\n$10\r\npsubscribe\r\n$%d\r\n%s\r\n:1\r\n", len(command[1]), command[1])
+		case "ping":
+			conn.Write([]byte("+PONG\r\n"))
+		default:
+			conn.Write([]byte("+OK\r\n"))
+		}
+	}
+}
+
+// Read a command sent as an array of bulk strings.
+func readCommand(reader *bufio.Reader) ([]string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	count, err := strconv.Atoi(strings.TrimSpace(line)[1:])
+	if err != nil {
+		return nil, err
+	}
+	command := []string{}
+	for i := 0; i < count; i++ {
+		if _, err := reader.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		arg, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		command = append(command, strings.TrimSuffix(arg, "\r\n"))
+	}
+	return command, nil
+}
+
+// Publish a message to a subscribed connection.
+func publish(t *testing.T, conn net.Conn, channel string, payload string) {
+	t.Helper()
+	if _, err := fmt.Fprintf(conn, "*4\r\n$8\r\npmessage\r\n$1\r\n*\r\n$%d\r\n%s\r\n$%d\r\n%s\r\n", len(channel), channel, len(payload), payload); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Get the last subscribed connection, the previous ones were dropped.
+func (r *fakeRedis) subscribed(t *testing.T) net.Conn {
+	t.Helper()
+	var conn net.Conn
+	for {
+		select {
+		case conn = <-r.conns:
+		default:
+			if conn == nil {
+				t.Fatal("the subscriber did not subscribe")
+			}
+			return conn
+		}
+	}
+}
+
+// Wait for the subscriber to report a state.
+func waitState(t *testing.T, status <-chan *Status, state string) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case s, ok := <-status:
+			if !ok {
+				t.Fatalf("the subscriber stopped before %s", state)
+			}
+			if s.State == state {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("the subscriber did not report %s", state)
+		}
+	}
+}
+
+func TestRedisSubscriberReconnects(t *testing.T) {
+	server := newFakeRedis(t)
+	sub := &RedisSubscriber{}
+	sub.reporter = newReporter("redis")
+	sub.ctx, sub.cancel = context.WithCancel(context.Background())
+	sub.keyPrefix = "echo:"
+	sub.options = &options.Config{}
+	sub.redis = redis.NewClient(&redis.Options{Addr: server.listener.Addr().String(), MaxRetries: -1})
+	t.Cleanup(func() { sub.redis.Close() })
+
+	received := make(chan string, 10)
+	sub.Subscribe(func(channel string, message *types.Data) {
+		received <- channel + ":" + message.Event
+	})
+	expect := func(event string) {
+		t.Helper()
+		select {
+		case e := <-received:
+			if e != event {
+				t.Fatalf("expected %s, got %s", event, e)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s is not broadcast", event)
+		}
+	}
+
+	waitState(t, sub.Status(), StateConnected)
+	conn := server.subscribed(t)
+	publish(t, conn, "echo:orders", "{not json")
+	publish(t, conn, "laravel-echo-server#request", `{"event":"Ignored"}`)
+	publish(t, conn, "echo:orders", `{"event":"OrderShipped","data":{}}`)
+	expect("orders:OrderShipped")
+
+	// The connection drops, the subscriber subscribes again.
+	conn.Close()
+	waitState(t, sub.Status(), StateReconnecting)
+	waitState(t, sub.Status(), StateConnected)
+	conn = server.subscribed(t)
+	publish(t, conn, "echo:news", `{"event":"Published","data":{}}`)
+	expect("news:Published")
+
+	sub.UnSubscribe()
+	waitState(t, sub.Status(), StateStopped)
+	select {
+	case e := <-received:
+		t.Fatalf("unexpected broadcast %s", e)
+	default:
+	}
+}
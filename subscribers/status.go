@@ -0,0 +1,80 @@
+package subscribers
+
+import (
+	"math/rand"
+	"time"
+)
+
+// States of the connection of a subscriber.
+const (
+	StateConnecting   = "connecting"
+	StateConnected    = "connected"
+	StateReconnecting = "reconnecting"
+	StateStopped      = "stopped"
+)
+
+// Delays between the reconnection attempts of a subscriber.
+const (
+	reconnectDelay    = 500 * time.Millisecond
+	maxReconnectDelay = 30 * time.Second
+)
+
+// A subscriber reporting the state changes of its connection.
+type StatusReporter interface {
+	// Get the state changes, the channel is closed once the subscriber stopped.
+	Status() <-chan *Status
+}
+
+// Sends the state changes of a subscriber.
+type reporter struct {
+
+	// Name of the subscriber.
+	name string
+
+	// State changes.
+	status chan *Status
+}
+
+func newReporter(name string) *reporter {
+	r := &reporter{}
+	r.name = name
+	r.status = make(chan *Status, 16)
+	return r
+}
+
+func (r *reporter) Status() <-chan *Status {
+	return r.status
+}
+
+// Report a state change, dropped if the reports are not consumed.
+func (r *reporter) report(state string, err error) {
+	status := &Status{
+		Subscriber: r.name,
+		State:      state,
+		Since:      time.Now(),
+	}
+	if err != nil {
+		status.Error = err.Error()
+	}
+	select {
+	case r.status <- status:
+	default:
+	}
+}
+
+// Report that the subscriber stopped, no report may follow.
+func (r *reporter) stop() {
+	r.report(StateStopped, nil)
+	close(r.status)
+}
+
+// The delay before a reconnection attempt, doubled on each attempt and jittered.
+func reconnectBackoff(attempt int) time.Duration {
+	delay := maxReconnectDelay
+	if attempt < 16 {
+		if d := reconnectDelay << attempt; d < maxReconnectDelay {
+			delay = d
+		}
+	}
+	return time.Duration(float64(delay) * (0.5 + rand.Float64()/2))
+}
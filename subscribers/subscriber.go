@@ -13,3 +13,19 @@ type Subscriber interface {
 	// Unsubscribe from events to broadcast.
 	UnSubscribe()
 }
+
+// A subscriber whose events reach every server node, like the messages of a Redis channel,
+// rather than a single one. Its events are not relayed to the other nodes of the cluster.
+type FanOutSubscriber interface {
+	// Check if every server node receives the events.
+	FansOut() bool
+}
+
+// A fan-out subscriber some of whose events reach a single server node, which relays them to the others.
+type RelayingSubscriber interface {
+	FanOutSubscriber
+
+	// Subscribe to events to broadcast, the events every node receives go to the first callback
+	// and those reaching this node alone to the second.
+	SubscribeRelayed(Broadcast, Broadcast)
+}
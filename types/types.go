@@ -1,31 +1,70 @@
 package types
 
 import (
-	"github.com/zishang520/socket.io/socket"
+	"bytes"
+	"encoding/json"
+	"errors"
 )
 
 type Auth struct {
-	Headers map[string]string `json:"headers" mapstructure:"headers"`
+	Headers   map[string]string `json:"headers" mapstructure:"headers"`
+	Signature string            `json:"signature,omitempty" mapstructure:"signature"`
 }
 
 type Data struct {
-	Channel string `json:"channel" mapstructure:"channel"`
-	Event   string `json:"event" mapstructure:"event"`
-	Data    any    `json:"data" mapstructure:"data"`
-	Auth    Auth   `json:"auth" mapstructure:"auth"`
-	Socket  string `json:"socket" mapstructure:"socket"`
+	Channel     string `json:"channel" mapstructure:"channel"`
+	Event       string `json:"event" mapstructure:"event"`
+	Data        any    `json:"data" mapstructure:"data"`
+	Auth        Auth   `json:"auth" mapstructure:"auth"`
+	ChannelData string `json:"channel_data,omitempty" mapstructure:"channel_data"`
+	Socket      string `json:"socket" mapstructure:"socket"`
+	Since       *int64 `json:"since,omitempty" mapstructure:"since"`
 }
 
 type Member struct {
-	SocketId socket.SocketId `json:"socket_id"`
-	UserId   uint64          `json:"user_id"`
-	UserInfo any             `json:"user_info"`
+	SocketId string `json:"socket_id"`
+	NodeId   string `json:"node_id,omitempty"`
+	UserId   UserId `json:"user_id"`
+	UserInfo any    `json:"user_info"`
+}
+
+// The id of a user, any JSON scalar kept as its JSON encoding, so ids of
+// different types never match and the original type is sent back.
+type UserId string
+
+func (id UserId) MarshalJSON() ([]byte, error) {
+	if id == "" {
+		return []byte("null"), nil
+	}
+	return []byte(id), nil
+}
+
+func (id *UserId) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || data[0] == '{' || data[0] == '[' || !json.Valid(data) {
+		return errors.New("The user id must be a string, a number or a boolean.")
+	}
+	if bytes.Equal(data, []byte("null")) {
+		*id = ""
+		return nil
+	}
+	*id = UserId(data)
+	return nil
+}
+
+// The user id as text, strings without their quotes.
+func (id UserId) String() string {
+	var value string
+	if err := json.Unmarshal([]byte(id), &value); err == nil {
+		return value
+	}
+	return string(id)
 }
 
 type Members []*Member
 
 func (members Members) Unique(reverse bool) (result Members) {
-	tempMap := map[uint64]struct{}{}
+	tempMap := map[UserId]struct{}{}
 	if reverse {
 		for i := len(members) - 1; i >= 0; i = i - 1 {
 			if _, ok := tempMap[members[i].UserId]; !ok {
@@ -45,10 +84,54 @@ func (members Members) Unique(reverse bool) (result Members) {
 	return result
 }
 
+type Membership struct {
+	Channel  string
+	SocketId string
+}
+
 type AuthenticateData struct {
-	ChannelData Member `json:"channel_data"`
+	ChannelData  Member `json:"channel_data"`
+	SharedSecret string `json:"shared_secret,omitempty"`
 }
 
 type PocessLockData struct {
 	Process int `json:"process"`
 }
+
+// An event reported to the webhooks.
+type WebhookEvent struct {
+	Name     string `json:"name"`
+	Channel  string `json:"channel"`
+	Event    string `json:"event,omitempty"`
+	Data     string `json:"data,omitempty"`
+	SocketId string `json:"socket_id,omitempty"`
+	UserId   string `json:"user_id,omitempty"`
+}
+
+// A webhook event waiting to be posted to a url.
+type WebhookJob struct {
+	Id       int64         `json:"-"`
+	Url      string        `json:"url"`
+	Event    *WebhookEvent `json:"event"`
+	Attempts int           `json:"attempts"`
+}
+
+// An event of the history of a channel, numbered in the order it was broadcast.
+type HistoryEvent struct {
+	Seq    int64  `json:"seq"`
+	Event  string `json:"event"`
+	Data   any    `json:"data"`
+	Except string `json:"except,omitempty"`
+}
+
+// Sent to a connection to recover its channels after a disconnect, and sent back by the next connection.
+type RecoverySession struct {
+	Id    string `json:"id" mapstructure:"id"`
+	Token string `json:"token" mapstructure:"token"`
+}
+
+// Sent to a resuming client when events it missed are no longer in the history.
+type HistoryGap struct {
+	Since int64 `json:"since"`
+	Seq   int64 `json:"seq"`
+}
@@ -0,0 +1,64 @@
+package types
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestUserIdRoundTrip(t *testing.T) {
+	for _, data := range []string{`42`, `"42"`, `"9b2ad8e4-1c3e-4b0e-a4f1-3f6a1c9f1e2d"`, `true`, `1.5`, `"é"`} {
+		var member Member
+		if err := json.Unmarshal([]byte(`{"user_id":`+data+`,"user_info":{"name":"a"}}`), &member); err != nil {
+			t.Fatalf("%s: %v", data, err)
+		}
+		result, err := json.Marshal(member.UserId)
+		if err != nil {
+			t.Fatalf("%s: %v", data, err)
+		}
+		if string(result) != data {
+			t.Errorf("%s is sent back as %s", data, result)
+		}
+	}
+}
+
+func TestUserIdKeepsType(t *testing.T) {
+	var number, text UserId
+	if err := json.Unmarshal([]byte(`42`), &number); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(`"42"`), &text); err != nil {
+		t.Fatal(err)
+	}
+	if number == text {
+		t.Error("the number and the string ids match")
+	}
+	if number.String() != "42" || text.String() != "42" {
+		t.Errorf("unexpected texts %q and %q", number.String(), text.String())
+	}
+	if members := (Members{{UserId: number}, {UserId: text}, {UserId: number}}).Unique(false); len(members) != 2 {
+		t.Errorf("expected 2 unique members, got %d", len(members))
+	}
+}
+
+func TestUserIdNull(t *testing.T) {
+	var member Member
+	if err := json.Unmarshal([]byte(`{"user_id":null}`), &member); err != nil {
+		t.Fatal(err)
+	}
+	if member.UserId != "" {
+		t.Errorf("null is kept as %q", member.UserId)
+	}
+	result, err := json.Marshal(member.UserId)
+	if err != nil || string(result) != "null" {
+		t.Errorf("an empty id is sent as %s (%v)", result, err)
+	}
+}
+
+func TestUserIdRefusesObjects(t *testing.T) {
+	for _, data := range []string{`{"id":1}`, `[1]`} {
+		var member Member
+		if err := json.Unmarshal([]byte(`{"user_id":`+data+`}`), &member); err == nil {
+			t.Errorf("%s is accepted as a user id", data)
+		}
+	}
+}
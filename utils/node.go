@@ -0,0 +1,15 @@
+package utils
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// The id of this server node, unique to the process.
+var NodeId string
+
+func init() {
+	data := make([]byte, 8)
+	rand.Read(data)
+	NodeId = hex.EncodeToString(data)
+}
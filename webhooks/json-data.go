@@ -0,0 +1,10 @@
+package webhooks
+
+import (
+	"github.com/larisgo/laravel-echo-server/types"
+)
+
+type Payload struct {
+	TimeMs int64                 `json:"time_ms"`
+	Events []*types.WebhookEvent `json:"events"`
+}
@@ -0,0 +1,313 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/larisgo/laravel-echo-server/database"
+	_http "github.com/larisgo/laravel-echo-server/http"
+	"github.com/larisgo/laravel-echo-server/options"
+	"github.com/larisgo/laravel-echo-server/types"
+	_utils "github.com/larisgo/laravel-echo-server/utils"
+	"github.com/zishang520/engine.io/utils"
+)
+
+// The webhook events.
+const (
+	ChannelOccupied = "channel_occupied"
+	ChannelVacated  = "channel_vacated"
+	MemberAdded     = "member_added"
+	MemberRemoved   = "member_removed"
+	ClientEvent     = "client_event"
+)
+
+// The longest delay before a failed webhook is posted again.
+const maxRetryDelay = time.Hour
+
+// A url and the events posted to it.
+type hook struct {
+	url    string
+	events map[string]bool
+}
+
+type Webhooks struct {
+
+	// Queue of the events to post, shared by the nodes of a cluster.
+	db database.DatabaseDriver
+
+	// Client posting the events.
+	client *_http.Client
+
+	// Configurable server options.
+	options *options.Config
+
+	// The urls to post to.
+	hooks []*hook
+
+	// The API client whose key and secret sign the requests.
+	key    string
+	secret string
+
+	// Stops the delivery.
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// Create a new webhooks instance, posting nothing unless enabled.
+func NewWebhooks(_options *options.Config) (w *Webhooks, err error) {
+	w = &Webhooks{}
+	w.options = _options
+	w.ctx, w.cancel = context.WithCancel(context.Background())
+
+	config := _options.Webhooks
+	if !config.Enabled || len(config.Hooks) == 0 {
+		return w, nil
+	}
+
+	for _, client := range _options.Clients {
+		if config.AppId == "" || client.AppId == config.AppId {
+			w.key, w.secret = client.Key, client.Secret
+			break
+		}
+	}
+	if w.secret == "" {
+		return nil, errors.New("The webhooks need an API client with a secret to sign the requests.")
+	}
+	for _, config := range config.Hooks {
+		h := &hook{url: config.Url, events: map[string]bool{}}
+		for _, event := range config.Events {
+			h.events[event] = true
+		}
+		w.hooks = append(w.hooks, h)
+	}
+
+	w.db, err = database.NewDatabase(_options)
+	if err != nil {
+		return nil, err
+	}
+	w.client = _http.NewClient(_options)
+
+	w.wg.Add(1)
+	go w.deliver()
+
+	if _options.DevMode {
+		utils.Log().Success("Webhooks are enabled.")
+	}
+	return w, nil
+}
+
+// Stop the delivery, the queued events are posted once started again.
+func (w *Webhooks) Close() error {
+	w.cancel()
+	w.wg.Wait()
+	if w.db != nil {
+		return w.db.Close()
+	}
+	return nil
+}
+
+// Check if an event is posted to any url.
+func (w *Webhooks) Wants(name string) bool {
+	for _, h := range w.hooks {
+		if h.wants(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Queue an event for the urls it is posted to.
+func (w *Webhooks) Trigger(event *types.WebhookEvent) {
+	jobs := []*types.WebhookJob{}
+	for _, h := range w.hooks {
+		if h.wants(event.Name) {
+			jobs = append(jobs, &types.WebhookJob{Url: h.url, Event: event})
+		}
+	}
+	if len(jobs) == 0 {
+		return
+	}
+	if err := w.db.PushWebhooks(jobs); err != nil {
+		utils.Log().Error("Unable to queue the %s webhook of %s: %v", event.Name, event.Channel, err)
+	}
+}
+
+// Change the number of subscribers of a channel on this node, returns the new number on every node.
+func (w *Webhooks) Occupy(channel string, delta int64) (int64, error) {
+	return w.db.Occupy(channel, _utils.NodeId, delta)
+}
+
+// Forget the subscribers of a stopped node and report the channels it leaves vacated.
+func (w *Webhooks) VacateNode(node string) error {
+	if w.db == nil {
+		return nil
+	}
+	channels, err := w.db.VacateNode(node)
+	if err != nil {
+		return err
+	}
+	for _, channel := range channels {
+		w.Trigger(&types.WebhookEvent{Name: ChannelVacated, Channel: channel})
+	}
+	return nil
+}
+
+// Check if an event is posted to the url, all of them are if none is listed.
+func (h *hook) wants(name string) bool {
+	return len(h.events) == 0 || h.events[name]
+}
+
+// Post the queued events in batches until stopped.
+func (w *Webhooks) deliver() {
+	defer w.wg.Done()
+
+	interval := time.Duration(w.options.Webhooks.BatchInterval) * time.Millisecond
+	if interval <= 0 {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.ctx.Done():
+			return
+		case <-ticker.C:
+			w.flush()
+		}
+	}
+}
+
+// Post the due events, batched by url, until none is left.
+func (w *Webhooks) flush() {
+	limit := w.options.Webhooks.BatchSize
+	if limit <= 0 {
+		limit = 50
+	}
+	for w.ctx.Err() == nil {
+		jobs, err := w.db.ClaimWebhooks(limit, w.lease())
+		if err != nil {
+			if w.options.DevMode {
+				utils.Log().Error("%v", err)
+			}
+			return
+		}
+
+		batches := map[string][]*types.WebhookJob{}
+		urls := []string{}
+		for _, job := range jobs {
+			if _, ok := batches[job.Url]; !ok {
+				urls = append(urls, job.Url)
+			}
+			batches[job.Url] = append(batches[job.Url], job)
+		}
+		for _, url := range urls {
+			w.post(url, batches[url])
+		}
+
+		if len(jobs) < limit {
+			return
+		}
+	}
+}
+
+// Post a batch of events, retrying it later if it fails.
+func (w *Webhooks) post(url string, jobs []*types.WebhookJob) {
+	err := w.send(url, jobs)
+	if err == nil {
+		ids := make([]int64, len(jobs))
+		for i, job := range jobs {
+			ids[i] = job.Id
+		}
+		if err := w.db.AckWebhooks(ids); err != nil && w.options.DevMode {
+			utils.Log().Error("%v", err)
+		}
+		return
+	}
+
+	for _, job := range jobs {
+		job.Attempts++
+		if job.Attempts >= w.options.Webhooks.MaxAttempts {
+			utils.Log().Error("Dropped the %s webhook of %s to %s after %d attempts: %v", job.Event.Name, job.Event.Channel, url, job.Attempts, err)
+			if err := w.db.AckWebhooks([]int64{job.Id}); err != nil && w.options.DevMode {
+				utils.Log().Error("%v", err)
+			}
+			continue
+		}
+		if err := w.db.RetryWebhook(job, time.Now().Add(w.backoff(job.Attempts))); err != nil && w.options.DevMode {
+			utils.Log().Error("%v", err)
+		}
+	}
+	if w.options.DevMode {
+		utils.Log().Warning("Retrying %d webhooks to %s: %v", len(jobs), url, err)
+	}
+}
+
+// Send a signed batch of events.
+func (w *Webhooks) send(url string, jobs []*types.WebhookJob) error {
+	payload := &Payload{TimeMs: time.Now().UnixMilli(), Events: make([]*types.WebhookEvent, len(jobs))}
+	for i, job := range jobs {
+		payload.Events[i] = job.Event
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	res, err := w.client.Request(&_http.Options{
+		Method: http.MethodPost,
+		Url:    url,
+		Headers: map[string]string{
+			"Content-Type":       "application/json",
+			"X-Pusher-Key":       w.key,
+			"X-Pusher-Signature": w.sign(body),
+		},
+		Body: bytes.NewReader(body),
+	})
+	if err != nil {
+		return err
+	}
+	if res.StatusCode < http.StatusOK || res.StatusCode >= http.StatusMultipleChoices {
+		return errors.New(fmt.Sprintf("Got HTTP status %d.", res.StatusCode))
+	}
+	return nil
+}
+
+// Sign a request body with the secret of the API client.
+func (w *Webhooks) sign(body []byte) string {
+	mac := hmac.New(sha256.New, []byte(w.secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// How long claimed events wait for their request before another node may post them.
+func (w *Webhooks) lease() time.Duration {
+	timeout := time.Duration(w.options.HttpClient.Timeout) * time.Millisecond
+	if timeout == 0 {
+		timeout = 30 * time.Second
+	}
+	return 2 * timeout
+}
+
+// The delay before a failed event is posted again, doubled on each attempt and jittered.
+func (w *Webhooks) backoff(attempt int) time.Duration {
+	delay := time.Duration(w.options.Webhooks.RetryDelay) * time.Millisecond
+	for i := 1; i < attempt && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	return time.Duration(float64(delay) * (0.5 + rand.Float64()))
+}